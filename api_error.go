@@ -1,6 +1,10 @@
 package nestapi
 
-import "strings"
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
 
 /*
 Error is the interface that includes the specific reason for the error
@@ -21,10 +25,17 @@ type APIError struct {
 	Message  string `json:"message"`
 	Instance string `json:"instance"`
 
+	// StatusCode is the HTTP status of the response that produced
+	// the error, or zero when no response was received.
+	StatusCode int `json:"-"`
+
 	// Set as an interface since it comes in as diffrent things and we
 	// can't know ahead of time what they will be. We don't really use
 	// this anyway, but here for completeness.
 	Details interface{} `json:"details"`
+
+	// the underlying error of a client side error, such as a timeout
+	cause error
 }
 
 /*
@@ -38,7 +49,23 @@ func (n *APIError) Error() string {
 Reason satisfies the nestapi Error interface
 */
 func (n *APIError) Reason() string {
-	return strings.Split(n.Type, "#")[1]
+	if n.Type == "" {
+		return n.OldError
+	}
+
+	parts := strings.SplitN(n.Type, "#", 2)
+	if len(parts) < 2 {
+		return n.Type
+	}
+	return parts[1]
+}
+
+/*
+Unwrap returns the underlying error of a client side error, e.g. the
+context.DeadlineExceeded behind a timeout, for use with errors.Is
+*/
+func (n *APIError) Unwrap() error {
+	return n.cause
 }
 
 /*
@@ -59,3 +86,27 @@ func (n *APIError) HumanMessage() string {
 	}
 	return n.Message
 }
+
+/*
+IsUnauthorized reports whether err is an APIError caused by missing
+or invalid credentials, e.g. an expired token
+*/
+func IsUnauthorized(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.StatusCode == http.StatusUnauthorized || apiErr.Reason() == "auth-error"
+}
+
+/*
+IsNotFound reports whether err is an APIError caused by the requested
+information not existing
+*/
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.StatusCode == http.StatusNotFound || apiErr.Reason() == "not-found"
+}
@@ -0,0 +1,42 @@
+package nestapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReason(t *testing.T) {
+	for _, tt := range []struct {
+		err    APIError
+		reason string
+	}{
+		{APIError{OldError: "permission denied"}, "permission denied"},
+		{APIError{Type: "https://developer.nest.com/documentation/cloud/error-messages#auth-error"}, "auth-error"},
+		{APIError{Type: "blocked"}, "blocked"},
+	} {
+		assert.NotPanics(t, func() {
+			assert.Equal(t, tt.reason, tt.err.Reason())
+		})
+	}
+}
+
+func TestIsUnauthorizedIsNotFound(t *testing.T) {
+	unauthorized := &APIError{StatusCode: http.StatusUnauthorized, OldError: "Permission denied"}
+	notFound := &APIError{StatusCode: http.StatusNotFound}
+	authError := &APIError{Type: "https://developer.nest.com/documentation/cloud/error-messages#auth-error"}
+
+	assert.True(t, IsUnauthorized(unauthorized))
+	assert.True(t, IsUnauthorized(fmt.Errorf("watching: %w", unauthorized)))
+	assert.True(t, IsUnauthorized(authError))
+	assert.False(t, IsUnauthorized(notFound))
+	assert.False(t, IsUnauthorized(errors.New("unauthorized")))
+
+	assert.True(t, IsNotFound(notFound))
+	assert.True(t, IsNotFound(&APIError{Type: "not-found"}))
+	assert.False(t, IsNotFound(unauthorized))
+	assert.False(t, IsNotFound(nil))
+}
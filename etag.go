@@ -0,0 +1,70 @@
+package nestapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// ErrETagMismatch is returned by SetIfMatch when the value stored at
+// the reference no longer matches the given ETag.
+var ErrETagMismatch = errors.New("nestapi: etag mismatch")
+
+// GetWithETag retrieves the value of the NestAPI reference, unmarshals
+// it into the given interface and returns its ETag for use with
+// SetIfMatch.
+func (n *NestAPI) GetWithETag(v interface{}) (string, error) {
+	header := http.Header{}
+	header.Set("X-Firebase-ETag", "true")
+
+	bytes, respHeader, err := n.doRequestHeader(context.Background(), "GET", header, nil)
+	if err != nil {
+		return "", err
+	}
+	if err := n.unmarshal(bytes, v); err != nil {
+		return "", err
+	}
+	return respHeader.Get("ETag"), nil
+}
+
+// SetIfMatch sets the value of the NestAPI reference only if the value
+// currently stored still has the given ETag, as returned by
+// GetWithETag. Otherwise ErrETagMismatch is returned.
+func (n *NestAPI) SetIfMatch(etag string, v interface{}) error {
+	bytes, err := n.marshal(v)
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{}
+	header.Set("if-match", etag)
+
+	_, _, err = n.doRequestHeader(context.Background(), "PUT", header, bytes)
+	if apiErr, ok := err.(*APIError); ok && apiErr.StatusCode == http.StatusPreconditionFailed {
+		return ErrETagMismatch
+	}
+	return err
+}
+
+// GetIfChanged retrieves the value of the NestAPI reference into the
+// given interface unless its ETag still matches etag, as returned by an
+// earlier GetWithETag or GetIfChanged. It returns the current ETag and
+// whether the value changed; if it didn't, v is left untouched.
+func (n *NestAPI) GetIfChanged(etag string, v interface{}) (string, bool, error) {
+	header := http.Header{}
+	header.Set("X-Firebase-ETag", "true")
+	header.Set("if-none-match", etag)
+
+	bytes, respHeader, err := n.doRequestHeader(context.Background(), "GET", header, nil)
+	if apiErr, ok := err.(*APIError); ok && apiErr.StatusCode == http.StatusNotModified {
+		return etag, false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	if err := n.unmarshal(bytes, v); err != nil {
+		return "", false, err
+	}
+	return respHeader.Get("ETag"), true, nil
+}
@@ -0,0 +1,54 @@
+package nestapi
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetIfMatch(t *testing.T) {
+	server := newTestServer(t)
+	server.Set("/counter", 1)
+	n := New(server.URL, nil).Child("counter")
+
+	var v int
+	etag, err := n.GetWithETag(&v)
+	require.NoError(t, err)
+	assert.Equal(t, 1, v)
+	assert.NotEmpty(t, etag)
+
+	require.NoError(t, n.SetIfMatch(etag, 2))
+	assert.Equal(t, json.Number("2"), server.Get("/counter"))
+
+	// the value changed since etag was read
+	assert.Equal(t, ErrETagMismatch, n.SetIfMatch(etag, 3))
+	assert.Equal(t, json.Number("2"), server.Get("/counter"))
+}
+
+func TestGetIfChanged(t *testing.T) {
+	server := newTestServer(t)
+	server.Set("/node", "a")
+	n := New(server.URL, nil).Child("node")
+
+	var v string
+	etag, changed, err := n.GetIfChanged("", &v)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "a", v)
+
+	v = "untouched"
+	same, changed, err := n.GetIfChanged(etag, &v)
+	require.NoError(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, etag, same)
+	assert.Equal(t, "untouched", v)
+
+	server.Set("/node", "b")
+	newETag, changed, err := n.GetIfChanged(etag, &v)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "b", v)
+	assert.NotEqual(t, etag, newETag)
+}
@@ -0,0 +1,109 @@
+package nestapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// maxGetWorkers bounds the number of concurrent requests of GetFields
+// and GetMany.
+const maxGetWorkers = 8
+
+// GetFields retrieves only the given children of the NestAPI reference,
+// with one concurrent Get per field, and stores each value in out under
+// its field. A field may be a path of several keys separated by "/".
+//
+// If some of the reads fail, the values of the others are still stored
+// and the errors are returned joined together.
+func (n *NestAPI) GetFields(fields []string, out map[string]interface{}) error {
+	return n.GetFieldsWithContext(context.Background(), fields, out)
+}
+
+// GetFieldsWithContext is like GetFields but all the requests are bound
+// to ctx.
+func (n *NestAPI) GetFieldsWithContext(ctx context.Context, fields []string, out map[string]interface{}) error {
+	var (
+		mtx  sync.Mutex
+		errs []error
+		wg   sync.WaitGroup
+	)
+
+	work := make(chan string)
+	workers := maxGetWorkers
+	if len(fields) < workers {
+		workers = len(fields)
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for field := range work {
+				var v interface{}
+				err := n.Child(field).GetWithContext(ctx, &v)
+
+				mtx.Lock()
+				if err != nil {
+					errs = append(errs, fmt.Errorf("nestapi: get field %s: %w", field, err))
+				} else {
+					out[field] = v
+				}
+				mtx.Unlock()
+			}
+		}()
+	}
+
+	for _, field := range fields {
+		work <- field
+	}
+	close(work)
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// GetMany retrieves the values of refs concurrently, with all requests
+// bound to ctx, and unmarshals each into the element of out at the same
+// index, which must be as long as refs.
+//
+// If some of the reads fail, the values of the others are still stored
+// and the errors are returned joined together.
+func GetMany(ctx context.Context, refs []*NestAPI, out []interface{}) error {
+	if len(out) != len(refs) {
+		return fmt.Errorf("nestapi: got %d values for %d references", len(out), len(refs))
+	}
+
+	var (
+		mtx  sync.Mutex
+		errs []error
+		wg   sync.WaitGroup
+	)
+
+	work := make(chan int)
+	workers := maxGetWorkers
+	if len(refs) < workers {
+		workers = len(refs)
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				if err := refs[i].GetWithContext(ctx, out[i]); err != nil {
+					mtx.Lock()
+					errs = append(errs, fmt.Errorf("nestapi: get %s: %w", refs[i].url, err))
+					mtx.Unlock()
+				}
+			}
+		}()
+	}
+
+	for i := range refs {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
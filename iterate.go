@@ -0,0 +1,265 @@
+package nestapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Iterate retrieves the value of the NestAPI reference and calls fn for
+// each of its children with the child's key, a NestAPI reference to the
+// child and its raw value. Iteration stops at the first error returned
+// by fn, which Iterate then returns.
+//
+// Children are visited in key order, integer keys first, unless the
+// reference has an OrderBy in which case the order of the response is
+// preserved. A missing node has no children.
+func (n *NestAPI) Iterate(fn func(key string, child *NestAPI, value json.RawMessage) error) error {
+	b, err := n.doRequestCtx(context.Background(), "GET", nil)
+	if err != nil {
+		return err
+	}
+
+	children, err := decodeChildren(b)
+	if err != nil {
+		return err
+	}
+
+	if n.params.Get(orderByParam) == "" {
+		sort.SliceStable(children, func(i, j int) bool {
+			return keyLess(children[i].key, children[j].key)
+		})
+	}
+
+	for _, c := range children {
+		if err := fn(c.key, n.Child(c.key), c.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetMap retrieves the children of the NestAPI reference as their raw
+// JSON keyed by their keys, so that children of different shapes can
+// each be decoded as needed. A missing node has no children.
+func (n *NestAPI) GetMap() (map[string]json.RawMessage, error) {
+	b, err := n.doRequestCtx(context.Background(), "GET", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	children, err := decodeChildren(b)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]json.RawMessage, len(children))
+	for _, c := range children {
+		m[c.key] = c.value
+	}
+	return m, nil
+}
+
+// GetOrdered retrieves the children of the NestAPI reference and stores
+// their raw values in out, sorted client side by the child key orderKey,
+// which may be a path, or by their key or value with "$key" and
+// "$value". Values are ordered as the server orders them: children
+// without the key first, then false, true, numbers, strings and
+// objects, with ties broken by key.
+//
+// Unlike OrderBy it works with servers that don't support ordering,
+// but the whole node is always read.
+func (n *NestAPI) GetOrdered(orderKey string, out *[]json.RawMessage) error {
+	b, err := n.doRequestCtx(context.Background(), "GET", nil)
+	if err != nil {
+		return err
+	}
+
+	children, err := decodeChildren(b)
+	if err != nil {
+		return err
+	}
+
+	values := make([]interface{}, len(children))
+	if orderKey != "$key" {
+		for i, c := range children {
+			var v interface{}
+			if err := decodeUseNumber(c.value, &v); err != nil {
+				return err
+			}
+			if orderKey != "$value" {
+				v = valueAt(v, splitPath(orderKey))
+			}
+			values[i] = v
+		}
+	}
+
+	idx := make([]int, len(children))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool {
+		a, b := idx[i], idx[j]
+		if c := compareValues(values[a], values[b]); c != 0 {
+			return c < 0
+		}
+		return keyLess(children[a].key, children[b].key)
+	})
+
+	*out = make([]json.RawMessage, len(children))
+	for i, j := range idx {
+		(*out)[i] = children[j].value
+	}
+	return nil
+}
+
+// compareValues orders values as the server does: null, false, true,
+// numbers, strings and then objects, which all compare equal.
+func compareValues(a, b interface{}) int {
+	ra, rb := valueRank(a), valueRank(b)
+	if ra != rb {
+		return ra - rb
+	}
+
+	switch a := a.(type) {
+	case json.Number:
+		fa, _ := a.Float64()
+		fb, _ := b.(json.Number).Float64()
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+	case string:
+		return strings.Compare(a, b.(string))
+	}
+	return 0
+}
+
+func valueRank(v interface{}) int {
+	switch v := v.(type) {
+	case nil:
+		return 0
+	case bool:
+		if !v {
+			return 1
+		}
+		return 2
+	case json.Number:
+		return 3
+	case string:
+		return 4
+	}
+	return 5
+}
+
+// ShallowKeys returns the keys of the children of the NestAPI
+// reference, in key order, without retrieving their values. A missing
+// node or a value that isn't an object has no keys. Any query of the
+// reference, e.g. OrderBy, is ignored.
+func (n *NestAPI) ShallowKeys() ([]string, error) {
+	m, err := n.shallowChildren()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keyLess(keys[i], keys[j])
+	})
+	return keys, nil
+}
+
+// shallowChildren returns the children of the NestAPI reference read
+// with a shallow read, none if it is missing or isn't an object.
+func (n *NestAPI) shallowChildren() (map[string]interface{}, error) {
+	var v interface{}
+	if err := n.ClearQuery().Shallow().Get(&v); err != nil {
+		return nil, err
+	}
+	m, _ := v.(map[string]interface{})
+	return m, nil
+}
+
+// Count returns the number of children of the NestAPI reference, with a
+// shallow read. A missing node or a value that isn't an object has no
+// children. The keys of all the children are still transferred, so it
+// is not cheap for huge nodes, and for those where the server limits
+// the shallow response the count is only approximate. Any query of the
+// reference is ignored.
+func (n *NestAPI) Count() (int, error) {
+	m, err := n.shallowChildren()
+	if err != nil {
+		return 0, err
+	}
+	return len(m), nil
+}
+
+type rawChild struct {
+	key   string
+	value json.RawMessage
+}
+
+// decodeChildren decodes the children of a JSON object, or of an array
+// as the server returns for integer keys, in the order they appear.
+func decodeChildren(b []byte) ([]rawChild, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	tok, err := d.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	delim, ok := tok.(json.Delim)
+	switch {
+	case tok == nil:
+		return nil, nil
+	case !ok || (delim != '{' && delim != '['):
+		return nil, fmt.Errorf("nestapi: cannot iterate over %s", b)
+	}
+
+	var children []rawChild
+	for i := 0; d.More(); i++ {
+		key := strconv.Itoa(i)
+		if delim == '{' {
+			if tok, err = d.Token(); err != nil {
+				return nil, err
+			}
+			key = tok.(string)
+		}
+
+		var value json.RawMessage
+		if err := d.Decode(&value); err != nil {
+			return nil, err
+		}
+		// arrays have holes for the missing keys
+		if string(value) == "null" {
+			continue
+		}
+		children = append(children, rawChild{key: key, value: value})
+	}
+	return children, nil
+}
+
+// keyLess orders keys as the server does: integer keys first in
+// numeric order, followed by the others in lexicographic order.
+func keyLess(a, b string) bool {
+	ia, errA := strconv.ParseInt(a, 10, 32)
+	ib, errB := strconv.ParseInt(b, 10, 32)
+	switch {
+	case errA == nil && errB == nil:
+		return ia < ib
+	case errA == nil:
+		return true
+	case errB == nil:
+		return false
+	}
+	return a < b
+}
@@ -0,0 +1,163 @@
+package nestapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCount(t *testing.T) {
+	server := newTestServer(t)
+	server.Set("/single", map[string]interface{}{"a": 1})
+	server.Set("/multi", map[string]interface{}{"a": 1, "b": map[string]interface{}{"c": 2}, "d": "e"})
+	server.Set("/leaf", 1)
+	n := New(server.URL, nil)
+
+	for path, want := range map[string]int{
+		"empty":  0,
+		"single": 1,
+		"multi":  3,
+		"leaf":   0,
+	} {
+		count, err := n.Child(path).Count()
+		require.NoError(t, err, path)
+		assert.Equal(t, want, count, path)
+	}
+}
+
+func TestIterate(t *testing.T) {
+	server := newTestServer(t)
+	server.Set("/list", map[string]interface{}{"b": 1, "10": 2, "a": 3, "2": 4})
+	n := New(server.URL, nil).Child("list")
+
+	var keys, paths []string
+	require.NoError(t, n.Iterate(func(key string, child *NestAPI, value json.RawMessage) error {
+		keys = append(keys, key)
+		paths = append(paths, child.Path())
+		return nil
+	}))
+	assert.Equal(t, []string{"2", "10", "a", "b"}, keys)
+	assert.Equal(t, []string{"/list/2", "/list/10", "/list/a", "/list/b"}, paths)
+
+	errStop := errors.New("stop")
+	calls := 0
+	err := n.Iterate(func(string, *NestAPI, json.RawMessage) error {
+		calls++
+		return errStop
+	})
+	assert.Equal(t, errStop, err)
+	assert.Equal(t, 1, calls)
+
+	calls = 0
+	require.NoError(t, n.Child("missing").Iterate(func(string, *NestAPI, json.RawMessage) error {
+		calls++
+		return nil
+	}))
+	assert.Equal(t, 0, calls)
+}
+
+func TestIterateOrderBy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"b":1,"c":2,"a":3}`))
+	}))
+	defer server.Close()
+
+	var keys []string
+	var values []string
+	require.NoError(t, New(server.URL, nil).OrderBy("$value").Iterate(func(key string, _ *NestAPI, value json.RawMessage) error {
+		keys = append(keys, key)
+		values = append(values, string(value))
+		return nil
+	}))
+	assert.Equal(t, []string{"b", "c", "a"}, keys)
+	assert.Equal(t, []string{"1", "2", "3"}, values)
+}
+
+func TestShallowKeys(t *testing.T) {
+	server := newTestServer(t)
+	server.Set("/list", map[string]interface{}{"b": 1, "10": 2, "a": map[string]interface{}{"c": 3}})
+	server.Set("/leaf", 1)
+	n := New(server.URL, nil)
+
+	keys, err := n.Child("list").ShallowKeys()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10", "a", "b"}, keys)
+
+	for _, path := range []string{"missing", "leaf"} {
+		keys, err := n.Child(path).ShallowKeys()
+		require.NoError(t, err, path)
+		assert.NotNil(t, keys, path)
+		assert.Empty(t, keys, path)
+	}
+}
+
+// jsonServer returns a server that answers every request with body.
+func jsonServer(t *testing.T, body string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGetOrdered(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		orderKey string
+		body     string
+		want     []string
+	}{
+		{
+			"child", "v",
+			`{"a":{"v":"x"},"b":{"v":true},"c":{},"d":{"v":false},"e":{"v":10},"f":{"v":{"o":1}},"g":{"v":2},"h":{"v":"a"}}`,
+			[]string{`{}`, `{"v":false}`, `{"v":true}`, `{"v":2}`, `{"v":10}`, `{"v":"a"}`, `{"v":"x"}`, `{"v":{"o":1}}`},
+		},
+		{
+			"nested child", "a/b",
+			`{"x":{"a":{"b":2}},"y":{"a":{"b":1}},"z":{"a":1}}`,
+			[]string{`{"a":1}`, `{"a":{"b":1}}`, `{"a":{"b":2}}`},
+		},
+		{
+			"key", "$key",
+			`{"b":"b","10":"10","a":"a","2":"2"}`,
+			[]string{`"2"`, `"10"`, `"a"`, `"b"`},
+		},
+		{
+			"value", "$value",
+			`{"x":3,"y":1,"z":"s","w":1}`,
+			[]string{`1`, `1`, `3`, `"s"`},
+		},
+		{"missing", "$value", `null`, []string{}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var out []json.RawMessage
+			require.NoError(t, New(jsonServer(t, tt.body).URL, nil).GetOrdered(tt.orderKey, &out))
+
+			got := []string{}
+			for _, v := range out {
+				got = append(got, string(v))
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestGetOrderedTiesByKey(t *testing.T) {
+	server := jsonServer(t, `{"b":{"k":"b","v":1},"10":{"k":"10","v":1},"a":{"k":"a","v":1},"2":{"k":"2","v":1}}`)
+
+	var out []json.RawMessage
+	require.NoError(t, New(server.URL, nil).GetOrdered("v", &out))
+
+	var keys []string
+	for _, v := range out {
+		var child struct{ K string }
+		require.NoError(t, json.Unmarshal(v, &child))
+		keys = append(keys, child.K)
+	}
+	assert.Equal(t, []string{"2", "10", "a", "b"}, keys)
+}
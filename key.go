@@ -0,0 +1,59 @@
+package nestapi
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// maxKeyLength is the maximum length of a key in bytes.
+const maxKeyLength = 768
+
+// ErrInvalidKey is returned, wrapped, when a key is rejected by
+// ValidateKey before a request is sent.
+var ErrInvalidKey = errors.New("nestapi: invalid key")
+
+// ValidateKey reports whether key can be used as a key in the database.
+// Keys must be non-empty, at most 768 bytes long, and must not contain
+// any of ". $ # [ ] /" or control characters. The returned error wraps
+// ErrInvalidKey.
+func ValidateKey(key string) error {
+	switch {
+	case key == "":
+		return fmt.Errorf("%w: empty key", ErrInvalidKey)
+	case len(key) > maxKeyLength:
+		return fmt.Errorf("%w: key longer than %d bytes", ErrInvalidKey, maxKeyLength)
+	case strings.ContainsAny(key, ".$#[]/"):
+		return fmt.Errorf("%w: %q contains one of \".$#[]/\"", ErrInvalidKey, key)
+	}
+	for _, r := range key {
+		if r < 0x20 || r == 0x7f {
+			return fmt.Errorf("%w: %q contains a control character", ErrInvalidKey, key)
+		}
+	}
+	return nil
+}
+
+// reservedRoots are the locations of the server's own data, e.g.
+// ".info/connected", whose names are not valid keys.
+var reservedRoots = map[string]bool{".info": true, ".settings": true}
+
+// validatePath validates each of the keys of a "/" separated path. If
+// root is true, the path is relative to the root of the database and
+// may start with one of the reserved locations, such as ".info".
+func validatePath(path string, root bool) error {
+	for _, key := range strings.Split(path, "/") {
+		if key == "" {
+			continue
+		}
+		if root && reservedRoots[key] {
+			root = false
+			continue
+		}
+		root = false
+		if err := ValidateKey(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
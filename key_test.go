@@ -0,0 +1,38 @@
+package nestapi
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChildReservedRoots(t *testing.T) {
+	root := New("https://example.com", nil)
+	for _, path := range []string{".info/connected", ".info/serverTimeOffset", ".settings/rules"} {
+		assert.NoError(t, root.Child(path).err, path)
+	}
+	assert.NoError(t, root.Child(".info").Child("connected").err)
+
+	for _, n := range []*NestAPI{
+		root.Child("a/.info"),
+		root.Child("a").Child(".settings"),
+		root.Child(".info/.settings"),
+	} {
+		assert.True(t, errors.Is(n.err, ErrInvalidKey), n.String())
+	}
+
+	assert.True(t, errors.Is(root.Child("a").UpdateMulti(map[string]interface{}{".info/x": 1}), ErrInvalidKey))
+}
+
+func TestParentRevalidates(t *testing.T) {
+	root := New("https://example.com", nil)
+
+	parent := root.Child("a/b$c").Parent()
+	assert.Equal(t, "/a", parent.Path())
+	assert.NoError(t, parent.err)
+
+	assert.NoError(t, root.Child("my key/b$c").Parent().err)
+	assert.NoError(t, root.Child(".info/connected").Parent().err)
+	assert.True(t, errors.Is(root.Child("a$b/c/d").Parent().err, ErrInvalidKey))
+}
@@ -5,9 +5,15 @@ package nestapi
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"log"
 	"net"
 	"net/http"
 	_url "net/url"
@@ -16,9 +22,10 @@ import (
 	"time"
 )
 
-// TimeoutDuration is the length of time any request will have to establish
-// a connection and receive headers from NestAPI before returning
-// an APIError timeout
+// The timeout durations are the defaults used by New when no client or
+// timeout options are given. A request that fails to establish a
+// connection or receive headers from NestAPI in time returns an
+// APIError timeout.
 var (
 	DialerTimeoutDuration         = 120 * time.Second
 	ResponseHeaderTimeoutDuration = 120 * time.Second
@@ -34,14 +41,68 @@ type ErrTimeout struct {
 
 // query parameter constants
 const (
-	authParam = "auth"
+	authParam        = "auth"
+	accessTokenParam = "access_token"
+	shallowParam     = "shallow"
+	orderByParam     = "orderBy"
+	printParam       = "print"
+	formatParam      = "format"
+	downloadParam    = "download"
+	timeoutParam     = "timeout"
+
+	limitToFirstParam = "limitToFirst"
+	limitToLastParam  = "limitToLast"
 )
 
+type basicAuth struct {
+	user, pass string
+}
+
+// Logger is the interface used by NestAPI for diagnostic output.
+// It is satisfied by *log.Logger.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
 // NestAPI represents a location in the cloud.
 type NestAPI struct {
-	url    string
-	params _url.Values
-	client *http.Client
+	url         string
+	params      _url.Values
+	client      *http.Client
+	ownsClient  bool
+	authParam   string
+	bearerToken string
+	authFunc    func() (string, error)
+	basicAuth   *basicAuth
+	header      http.Header
+	opts        options
+
+	// err is returned by every request of the reference, e.g. because
+	// its path has an invalid key
+	err error
+	// queryErr is reported by Validate, e.g. because of an invalid
+	// QueryTimeout, until the query is cleared
+	queryErr error
+
+	// RetryConfig controls retrying of requests that fail with
+	// a transient error. The zero value disables retries.
+	RetryConfig RetryConfig
+
+	// OnRequest, if set, is called before every HTTP request is sent.
+	OnRequest func(method, url string)
+	// OnResponse, if set, is called after every HTTP request completes,
+	// with the status of the response, or zero if none was received.
+	OnResponse func(method, url string, status int, dur time.Duration, err error)
+
+	// Logger receives diagnostic output, such as the security rules
+	// debug output while watching. If nil, the standard logger is used.
+	Logger Logger
+	// RawStreamWriter, if set, receives a copy of the raw event stream
+	// read while watching, decompressed if need be, for debugging.
+	RawStreamWriter io.Writer
+	// RulesDebugEvents sends the security rules debug output while
+	// watching as EventTypeRulesDebug events instead of logging it.
+	RulesDebugEvents bool
 
 	eventMtx   sync.Mutex
 	eventFuncs map[string]chan struct{}
@@ -49,6 +110,15 @@ type NestAPI struct {
 	watchMtx     sync.Mutex
 	watching     bool
 	stopWatching chan struct{}
+	drainWatch   chan struct{}
+	watchDone    chan struct{}
+	lastEventID  string
+	watchErr     error
+
+	// respMtx guards the state recorded from responses
+	respMtx     sync.Mutex
+	resolvedURL string
+	rateLimit   *RateLimit
 }
 
 func sanitizeURL(url string) string {
@@ -63,16 +133,22 @@ func sanitizeURL(url string) string {
 	return url
 }
 
-// Preserve headers on redirect.
+// Preserve headers on redirect, following at most limit redirects.
 //
 // Reference https://github.com/golang/go/issues/4800
-func redirectPreserveHeaders(req *http.Request, via []*http.Request) error {
+func redirectPreserveHeaders(limit int) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		return checkRedirect(req, via, limit)
+	}
+}
+
+func checkRedirect(req *http.Request, via []*http.Request, limit int) error {
 	if len(via) == 0 {
 		// No redirects
 		return nil
 	}
 
-	if len(via) > defaultRedirectLimit {
+	if len(via) > limit {
 		return fmt.Errorf("%d consecutive requests(redirects)", len(via))
 	}
 
@@ -84,22 +160,41 @@ func redirectPreserveHeaders(req *http.Request, via []*http.Request) error {
 }
 
 // New creates a new NestAPI reference,
-// if client is nil, http.DefaultClient is used.
-func New(url string, client *http.Client) *NestAPI {
+// if client is nil, a client is built from the given options,
+// which default to the package-level timeout durations.
+func New(url string, client *http.Client, opts ...Option) *NestAPI {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
 
+	ownsClient := client == nil
 	if client == nil {
+		tlsConfig := o.tlsConfig
+		if o.insecureSkipVerify {
+			if tlsConfig == nil {
+				tlsConfig = &tls.Config{}
+			} else {
+				tlsConfig = tlsConfig.Clone()
+			}
+			tlsConfig.InsecureSkipVerify = true
+		}
+
 		var tr *http.Transport
 		tr = &http.Transport{
-			ResponseHeaderTimeout: ResponseHeaderTimeoutDuration,
+			Proxy:                 o.proxy,
+			TLSClientConfig:       tlsConfig,
+			ResponseHeaderTimeout: o.responseHeaderTimeout,
 			DialContext: (&net.Dialer{
-				Timeout:   DialerTimeoutDuration,
-				KeepAlive: KeepAliveTimeoutDuration,
+				Timeout:   o.dialerTimeout,
+				KeepAlive: o.keepAliveTimeout,
 			}).DialContext,
 		}
 
 		client = &http.Client{
 			Transport:     tr,
-			CheckRedirect: redirectPreserveHeaders,
+			CheckRedirect: redirectPreserveHeaders(o.maxRedirects),
+			Timeout:       o.requestTimeout,
 		}
 	}
 
@@ -107,35 +202,361 @@ func New(url string, client *http.Client) *NestAPI {
 		url:          sanitizeURL(url),
 		params:       _url.Values{},
 		client:       client,
+		ownsClient:   ownsClient,
+		opts:         o,
 		stopWatching: make(chan struct{}),
 		eventFuncs:   map[string]chan struct{}{},
 	}
 }
 
+// NewRef creates a new NestAPI reference for the path made of the given
+// segments below host, with a client built from the default options.
+// Each segment is URL-escaped, so it may contain any character, and
+// empty segments are skipped.
+func NewRef(host string, pathSegments ...string) *NestAPI {
+	url := sanitizeURL(host)
+	for _, s := range pathSegments {
+		if s != "" {
+			url += "/" + _url.PathEscape(s)
+		}
+	}
+	return New(url, nil)
+}
+
 // Auth sets the custom NestAPI token used to authenticate to NestAPI.
 func (n *NestAPI) Auth(token string) {
-	n.params.Set(authParam, token)
+	n.params.Set(n.authParamName(), token)
+}
+
+// SetAuthParam sets the name of the query parameter Auth sends the
+// token in, "auth" by default. A token that is already set is moved
+// to the new parameter.
+func (n *NestAPI) SetAuthParam(name string) {
+	old := n.authParamName()
+	n.authParam = name
+
+	if token := n.params.Get(old); token != "" && old != name {
+		n.params.Del(old)
+		n.params.Set(name, token)
+	}
+}
+
+func (n *NestAPI) authParamName() string {
+	if n.authParam == "" {
+		return authParam
+	}
+	return n.authParam
+}
+
+// AuthBearer sets the OAuth2 access token sent in the Authorization
+// header, as required by the Nest cloud API.
+//
+// If several auth methods are set, only one is sent: AuthBearer takes
+// precedence over AuthAccessToken, which takes precedence over Auth.
+func (n *NestAPI) AuthBearer(token string) {
+	n.bearerToken = token
+}
+
+// SetAuthProvider sets a func that is called just before every request,
+// including each retry, redirect and watch reconnection, to obtain the
+// OAuth2 access token sent in the Authorization header, so that tokens
+// can be rotated without rebuilding references. It takes the place of
+// AuthBearer. If fn returns an error the request fails with it.
+//
+// fn is called from whichever goroutine makes the request, so it must
+// be safe for concurrent use, and it should cache the token rather than
+// fetch a new one every time. A nil fn removes the provider.
+func (n *NestAPI) SetAuthProvider(fn func() (string, error)) {
+	n.authFunc = fn
+}
+
+// AuthAccessToken sets the OAuth2 access token sent in the access_token
+// query parameter, as some Google-issued tokens require. See AuthBearer
+// for the precedence of the auth methods.
+func (n *NestAPI) AuthAccessToken(token string) {
+	n.params.Set(accessTokenParam, token)
+}
+
+// SetBasicAuth sets the HTTP Basic credentials sent with every request,
+// e.g. for a proxy in front of the Nest API. They are independent of the
+// auth token, but share the Authorization header with AuthBearer, which
+// takes precedence if both are set.
+func (n *NestAPI) SetBasicAuth(user, pass string) {
+	n.basicAuth = &basicAuth{user: user, pass: pass}
+}
+
+// SetHeader sets a header sent with every request, e.g. an API key
+// required by a gateway. References created from this one afterwards,
+// e.g. with Child, inherit the header.
+func (n *NestAPI) SetHeader(key, value string) {
+	if n.header == nil {
+		n.header = http.Header{}
+	}
+	n.header.Set(key, value)
 }
 
 // Unauth removes the current token being used to authenticate to NestAPI.
 func (n *NestAPI) Unauth() {
-	n.params.Del(authParam)
+	n.params.Del(n.authParamName())
+	n.params.Del(accessTokenParam)
+	n.bearerToken = ""
+	n.authFunc = nil
+}
+
+// Client returns the http.Client used by the NestAPI reference.
+func (n *NestAPI) Client() *http.Client {
+	return n.client
+}
+
+// SetClient replaces the http.Client used by the NestAPI reference.
+//
+// References previously created from this one, e.g. with Child,
+// keep using the client they were created with.
+func (n *NestAPI) SetClient(c *http.Client) {
+	n.client = c
+	n.ownsClient = false
+}
+
+// Close stops watching and, if the client was built by New, closes its
+// idle connections. A client given to New or SetClient is left alone.
+//
+// It is safe to Close a reference whose client is shared with other
+// references, e.g. its children; they open new connections as needed.
+func (n *NestAPI) Close() {
+	n.StopWatching()
+	if n.ownsClient {
+		n.client.CloseIdleConnections()
+	}
+}
+
+// CloseIdleConnections closes the pooled connections of the client of
+// the NestAPI reference that are not in use, e.g. after a network
+// change, so that later requests open new ones. It applies to a client
+// given to New or SetClient too, if its transport supports it. Open
+// connections, such as those of watches, are unaffected.
+func (n *NestAPI) CloseIdleConnections() {
+	n.client.CloseIdleConnections()
 }
 
 // Set the value of the NestAPI reference.
+//
+// Setting nil removes the value, though Remove states that intent
+// more clearly.
 func (n *NestAPI) Set(v interface{}) error {
-	bytes, err := json.Marshal(v)
+	return n.SetWithContext(context.Background(), v)
+}
+
+// SetWithContext is like Set but the request is bound to ctx.
+func (n *NestAPI) SetWithContext(ctx context.Context, v interface{}) error {
+	bytes, err := n.marshal(v)
 	if err != nil {
 		return err
 	}
-	_, err = n.doRequest("PUT", bytes)
+	_, err = n.doRequestCtx(ctx, "PUT", bytes)
+	return err
+}
+
+// SetWithTimeout is like Set but fails with a timeout APIError if
+// the request doesn't complete within d.
+func (n *NestAPI) SetWithTimeout(d time.Duration, v interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+
+	err := n.SetWithContext(ctx, v)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return timeoutError(ctx.Err())
+	}
+	return err
+}
+
+// SetAndGet sets the value of the NestAPI reference and unmarshals the
+// value stored by the server, as echoed back in the response, into out.
+// It must not be used with Silent, which suppresses the echo.
+func (n *NestAPI) SetAndGet(v interface{}, out interface{}) error {
+	bytes, err := n.marshal(v)
+	if err != nil {
+		return err
+	}
+	bytes, err = n.doRequestCtx(context.Background(), "PUT", bytes)
+	if err != nil {
+		return err
+	}
+	return n.unmarshal(bytes, out)
+}
+
+// Update the specific child with the given value.
+//
+// Only the keys present in v are written; any sibling keys
+// already stored at the reference are left untouched. Keys whose
+// value is nil are removed.
+func (n *NestAPI) Update(v interface{}) error {
+	return n.UpdateWithContext(context.Background(), v)
+}
+
+// UpdateWithContext is like Update but the request is bound to ctx.
+func (n *NestAPI) UpdateWithContext(ctx context.Context, v interface{}) error {
+	bytes, err := n.marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = n.doRequestCtx(ctx, "PATCH", bytes)
+	return err
+}
+
+// SetChildren sets each of the children of the NestAPI reference named
+// by the keys of m to its value, in a single request. Unlike Set, which
+// replaces the whole node, children not in m are left untouched.
+func (n *NestAPI) SetChildren(m map[string]interface{}) error {
+	for k := range m {
+		if err := ValidateKey(k); err != nil {
+			return err
+		}
+	}
+	return n.Update(m)
+}
+
+// UpdateMulti atomically updates several locations below the NestAPI
+// reference in a single request. The keys of updates are paths relative
+// to the reference, e.g. "users/u1/name". If any of the writes is
+// rejected, e.g. by the security rules, none of them are applied.
+func (n *NestAPI) UpdateMulti(updates map[string]interface{}) error {
+	root := n.Path() == "/"
+	for path := range updates {
+		if err := validatePath(path, root); err != nil {
+			return err
+		}
+	}
+	return n.Update(updates)
+}
+
+// Push creates a new child of the NestAPI reference with a
+// server-generated key and returns that key.
+func (n *NestAPI) Push(v interface{}) (string, error) {
+	return n.PushWithContext(context.Background(), v)
+}
+
+// PushWithContext is like Push but the request is bound to ctx.
+func (n *NestAPI) PushWithContext(ctx context.Context, v interface{}) (string, error) {
+	bytes, err := n.marshal(v)
+	if err != nil {
+		return "", err
+	}
+	bytes, err = n.doRequestCtx(ctx, "POST", bytes)
+	if err != nil {
+		return "", err
+	}
+
+	var m struct {
+		Name string `json:"name"`
+	}
+	if len(bytes) == 0 {
+		return "", fmt.Errorf("nestapi: push to %s returned an empty response", n.url)
+	}
+	if err := json.Unmarshal(bytes, &m); err != nil {
+		return "", err
+	}
+	if m.Name == "" {
+		return "", fmt.Errorf("nestapi: push to %s returned no name: %s", n.url, bytes)
+	}
+	return m.Name, nil
+}
+
+// Remove the NestAPI reference from the cloud.
+func (n *NestAPI) Remove() error {
+	return n.RemoveWithContext(context.Background())
+}
+
+// RemoveWithContext is like Remove but the request is bound to ctx.
+func (n *NestAPI) RemoveWithContext(ctx context.Context) error {
+	_, err := n.doRequestCtx(ctx, "DELETE", nil)
+	return err
+}
+
+// RemoveChildren removes the children of the NestAPI reference with
+// the given keys in a single, atomic request, leaving their siblings
+// in place.
+func (n *NestAPI) RemoveChildren(keys []string) error {
+	updates := make(map[string]interface{}, len(keys))
+	root := n.Path() == "/"
+	for _, k := range keys {
+		if err := validatePath(k, root); err != nil {
+			return err
+		}
+		updates[k] = nil
+	}
+	return n.Update(updates)
+}
+
+// Get retrieves the value of the NestAPI reference and
+// unmarshals it into the given interface.
+func (n *NestAPI) Get(v interface{}) error {
+	return n.GetWithContext(context.Background(), v)
+}
+
+// GetWithContext is like Get but the request is bound to ctx.
+func (n *NestAPI) GetWithContext(ctx context.Context, v interface{}) error {
+	bytes, err := n.doRequestCtx(ctx, "GET", nil)
+	if err != nil {
+		return err
+	}
+	return n.unmarshal(bytes, v)
+}
+
+// GetRaw retrieves the value of the NestAPI reference as the raw JSON
+// returned by the server. A missing value is returned as "null".
+func (n *NestAPI) GetRaw() ([]byte, error) {
+	return n.GetRawWithContext(context.Background())
+}
+
+// GetRawWithContext is like GetRaw but the request is bound to ctx.
+func (n *NestAPI) GetRawWithContext(ctx context.Context) ([]byte, error) {
+	return n.doRequestCtx(ctx, "GET", nil)
+}
+
+// GetStream is like Get but decodes the value as it is read from the
+// response, rather than reading it whole first, which reduces the memory
+// used by reads of large nodes.
+func (n *NestAPI) GetStream(v interface{}) error {
+	return n.GetStreamWithContext(context.Background(), v)
+}
+
+// GetStreamWithContext is like GetStream but the request, including
+// the reading of the response, is bound to ctx.
+func (n *NestAPI) GetStreamWithContext(ctx context.Context, v interface{}) error {
+	_, _, err := n.doRequest(ctx, "GET", nil, nil, func(r io.Reader) error {
+		d := json.NewDecoder(r)
+		if n.opts.useNumber {
+			d.UseNumber()
+		}
+		return d.Decode(v)
+	})
+	return err
+}
+
+// Exists reports whether a value is stored at the NestAPI reference,
+// without retrieving the values of its children. Any query of the
+// reference is ignored.
+func (n *NestAPI) Exists() (bool, error) {
+	b, err := n.ClearQuery().Shallow().doRequestCtx(context.Background(), "GET", nil)
+	if err != nil {
+		return false, err
+	}
+	return string(bytes.TrimSpace(b)) != "null", nil
+}
+
+// Ping checks that the database can be reached with the configured
+// authentication, with a shallow read of the root. It returns nil if the
+// read succeeds, or the error it failed with, e.g. an APIError for which
+// IsUnauthorized reports true.
+func (n *NestAPI) Ping() error {
+	_, err := n.Root().ClearQuery().Shallow().doRequestCtx(context.Background(), "GET", nil)
 	return err
 }
 
 // String returns the string representation of the
 // NestAPI reference.
 func (n *NestAPI) String() string {
-	path := n.url + "/.json"
+	path := n.url + n.opts.pathSuffix
 
 	if len(n.params) > 0 {
 		path += "?" + n.params.Encode()
@@ -144,20 +565,109 @@ func (n *NestAPI) String() string {
 }
 
 // Child creates a new NestAPI reference for the requested
-// child with the same configuration as the parent.
+// child with the same configuration as the parent. The child may be a
+// path of several keys separated by "/", each of which is URL-escaped.
+// If a key is invalid, every request of the child fails with an error
+// wrapping ErrInvalidKey. The server's own locations, ".info" and
+// ".settings", are accepted as the first key below the root.
 func (n *NestAPI) Child(child string) *NestAPI {
 	c := n.copy()
-	c.url = c.url + "/" + child
+	if c.err == nil {
+		c.err = validatePath(child, n.Path() == "/")
+	}
+	for _, key := range strings.Split(child, "/") {
+		if key != "" {
+			c.url += "/" + _url.PathEscape(key)
+		}
+	}
 	return c
 }
 
+// Key returns the last path segment of the NestAPI reference,
+// unescaped, or an empty string for the root.
+func (n *NestAPI) Key() string {
+	_, path := n.splitURL()
+	key := path[strings.LastIndex(path, "/")+1:]
+	if k, err := _url.PathUnescape(key); err == nil {
+		return k
+	}
+	return key
+}
+
+// Path returns the path of the NestAPI reference below the root, as it
+// appears in its URL, e.g. "/devices/thermostats/abc". The path of the
+// root is "/".
+func (n *NestAPI) Path() string {
+	_, path := n.splitURL()
+	return "/" + path
+}
+
+// Parent creates a new NestAPI reference for the parent of the
+// reference with the same configuration. The parent of the root
+// is the root itself. Its requests only fail with ErrInvalidKey if
+// its own path has an invalid key.
+func (n *NestAPI) Parent() *NestAPI {
+	c := n.copy()
+	base, path := n.splitURL()
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		path = path[:i]
+		c.url = base + "/" + path
+	} else {
+		path = ""
+		c.url = base
+	}
+
+	// the invalid key may have been the one left out
+	keys, err := _url.PathUnescape(path)
+	if err == nil {
+		err = validatePath(keys, true)
+	}
+	c.err = err
+	return c
+}
+
+// Root creates a new NestAPI reference for the root of the
+// database with the same configuration.
+func (n *NestAPI) Root() *NestAPI {
+	c := n.copy()
+	c.url, _ = n.splitURL()
+	c.err = nil
+	return c
+}
+
+// splitURL splits the reference url into its scheme and host and
+// the path below it, without leading or trailing slashes.
+func (n *NestAPI) splitURL() (string, string) {
+	host := strings.Index(n.url, "://") + len("://")
+	i := strings.Index(n.url[host:], "/")
+	if i < 0 {
+		return n.url, ""
+	}
+	return n.url[:host+i], strings.Trim(n.url[host+i:], "/")
+}
+
 func (n *NestAPI) copy() *NestAPI {
 	c := &NestAPI{
-		url:          n.url,
-		params:       _url.Values{},
-		client:       n.client,
-		stopWatching: make(chan struct{}),
-		eventFuncs:   map[string]chan struct{}{},
+		url:              n.url,
+		err:              n.err,
+		queryErr:         n.queryErr,
+		params:           _url.Values{},
+		client:           n.client,
+		ownsClient:       n.ownsClient,
+		opts:             n.opts,
+		authParam:        n.authParam,
+		bearerToken:      n.bearerToken,
+		authFunc:         n.authFunc,
+		basicAuth:        n.basicAuth,
+		header:           n.header.Clone(),
+		RetryConfig:      n.RetryConfig,
+		Logger:           n.Logger,
+		OnRequest:        n.OnRequest,
+		OnResponse:       n.OnResponse,
+		RawStreamWriter:  n.RawStreamWriter,
+		RulesDebugEvents: n.RulesDebugEvents,
+		stopWatching:     make(chan struct{}),
+		eventFuncs:       map[string]chan struct{}{},
 	}
 
 	// making sure to manually copy the map items into a new
@@ -168,74 +678,299 @@ func (n *NestAPI) copy() *NestAPI {
 	return c
 }
 
-func (n *NestAPI) doRequest(method string, body []byte) ([]byte, error) {
-	req, err := http.NewRequest(method, n.String(), bytes.NewReader(body))
+// newRequest builds a request against the given url with the
+// configured headers and authentication applied.
+func (n *NestAPI) newRequest(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
 		return nil, err
 	}
 
+	for k, v := range n.header {
+		req.Header[k] = v
+	}
+
+	if n.opts.compression && method == "GET" {
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
+
+	if n.basicAuth != nil {
+		req.SetBasicAuth(n.basicAuth.user, n.basicAuth.pass)
+	}
+
+	bearerToken := n.bearerToken
+	if n.authFunc != nil {
+		if bearerToken, err = n.authFunc(); err != nil {
+			return nil, fmt.Errorf("nestapi: auth provider: %w", err)
+		}
+	}
+
+	// only the auth method with the highest precedence is sent:
+	// the bearer token, then the access_token param, then the auth param
+	switch {
+	case bearerToken != "":
+		q := req.URL.Query()
+		q.Del(accessTokenParam)
+		q.Del(n.authParamName())
+		req.URL.RawQuery = q.Encode()
+		req.Header.Set("Authorization", "Bearer "+bearerToken)
+	case n.params.Get(accessTokenParam) != "" && n.authParamName() != accessTokenParam:
+		q := req.URL.Query()
+		q.Del(n.authParamName())
+		req.URL.RawQuery = q.Encode()
+	}
+	return req, nil
+}
+
+func (n *NestAPI) doRequestCtx(ctx context.Context, method string, body []byte) ([]byte, error) {
+	respBody, _, err := n.doRequestHeader(ctx, method, nil, body)
+	return respBody, err
+}
+
+// doRequestHeader performs the request with the extra header set and
+// returns the body and header of the response.
+func (n *NestAPI) doRequestHeader(ctx context.Context, method string, header http.Header, body []byte) ([]byte, http.Header, error) {
+	return n.doRequest(ctx, method, header, body, nil)
+}
+
+// doRequest performs the request, retrying it as configured. If decode
+// is not nil, the body of a successful response is streamed to it
+// rather than returned.
+func (n *NestAPI) doRequest(ctx context.Context, method string, header http.Header, body []byte, decode func(io.Reader) error) ([]byte, http.Header, error) {
+	if n.err != nil {
+		return nil, nil, n.err
+	}
+	if method == "GET" {
+		if err := n.Validate(); err != nil {
+			return nil, nil, err
+		}
+	}
+	for attempt := 0; ; attempt++ {
+		respBody, respHeader, err := n.doRequestOnce(ctx, method, n.String(), header, body, decode, 0)
+		if err == nil || !n.RetryConfig.shouldRetry(method, err, attempt) {
+			return respBody, respHeader, err
+		}
+
+		t := time.NewTimer(n.RetryConfig.delay(attempt, respHeader))
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return nil, respHeader, timeoutError(ctx.Err())
+		}
+	}
+}
+
+func (n *NestAPI) doRequestOnce(ctx context.Context, method, url string, header http.Header, body []byte, decode func(io.Reader) error, redirects int) (_ []byte, _ http.Header, err error) {
+	if n.OnRequest != nil {
+		n.OnRequest(method, url)
+	}
+	status := 0
+	if n.OnResponse != nil {
+		start := time.Now()
+		defer func() {
+			n.OnResponse(method, url, status, time.Since(start), err)
+		}()
+	}
+
+	req, err := n.newRequest(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
 	resp, err := n.client.Do(req)
+	if resp != nil {
+		status = resp.StatusCode
+	}
 	switch err := err.(type) {
 	default:
-		return nil, err
+		return nil, nil, err
 
 	case nil:
 		// check for 307 redirect
 		if resp.StatusCode == http.StatusTemporaryRedirect {
 			loc, err := resp.Location()
+			resp.Body.Close()
 			if err != nil {
-				return nil, err
+				return nil, nil, err
+			}
+			if redirects >= n.opts.maxRedirects {
+				return nil, nil, fmt.Errorf("%d consecutive requests(redirects)", redirects+1)
 			}
 
-			n.url = strings.Split(loc.String(), "/.json")[0]
-			return n.doRequest(method, body)
+			// follow the redirect without rebinding the reference, which
+			// may be in use by other goroutines. The new request gets the
+			// bearer token, custom headers and extra header applied again.
+			return n.doRequestOnce(ctx, method, loc.String(), header, body, decode, redirects+1)
 		}
 
 	case *_url.Error:
 		// `http.Client.Do` will return a `url.Error` that wraps a `net.Error`
 		// when exceeding it's `Transport`'s `ResponseHeadersTimeout`
+		// as it does when the context's deadline is exceeded, while
+		// a cancelled context is returned as is
 		e1, ok := err.Err.(net.Error)
 		if ok && e1.Timeout() {
-			return nil, apiTimeoutError()
+			return nil, nil, apiTimeoutError(err)
 		}
 
-		return nil, err
+		return nil, nil, err
 
 	case net.Error:
 		// `http.Client.Do` will return a `net.Error` directly when Dial times
 		// out, or when the Client's RoundTripper otherwise returns an err
 		if err.Timeout() {
-			return nil, apiTimeoutError()
+			return nil, nil, apiTimeoutError(err)
 		}
 
-		return nil, err
+		return nil, nil, err
 	}
 
 	defer resp.Body.Close()
-	respBody, err := ioutil.ReadAll(resp.Body)
+	n.recordRateLimit(resp.Header)
+
+	r, err := decodeBody(resp)
+	if err != nil {
+		return nil, resp.Header, err
+	}
+
+	if decode != nil && resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		if err := decode(r); err != nil {
+			return nil, resp.Header, timeoutError(err)
+		}
+		n.setResolvedURL(resp.Request.URL)
+		return nil, resp.Header, nil
+	}
+
+	respBody, err := ioutil.ReadAll(r)
 	if err != nil {
+		return nil, resp.Header, timeoutError(err)
+	}
+
+	// a missing value is null, as the server itself returns it
+	if resp.StatusCode == http.StatusNotFound && n.opts.treat404AsNil && method == "GET" {
+		respBody = []byte("null")
+		if decode != nil {
+			return nil, resp.Header, decode(bytes.NewReader(respBody))
+		}
+		return respBody, resp.Header, nil
+	}
+
+	// a 204 No Content (e.g. print=silent) is a success with no body
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, resp.Header, newAPIError(resp.StatusCode, respBody)
+	}
+	n.setResolvedURL(resp.Request.URL)
+	return respBody, resp.Header, nil
+}
+
+// ResolvedURL returns the base URL that the last successful request was
+// served from, after following any redirects, or an empty string if no
+// request has succeeded yet.
+func (n *NestAPI) ResolvedURL() string {
+	n.respMtx.Lock()
+	defer n.respMtx.Unlock()
+	return n.resolvedURL
+}
+
+func (n *NestAPI) setResolvedURL(u *_url.URL) {
+	base := *u
+	base.RawQuery = ""
+	base.Path = strings.TrimSuffix(base.Path, n.opts.pathSuffix)
+	base.RawPath = strings.TrimSuffix(base.RawPath, n.opts.pathSuffix)
+
+	n.respMtx.Lock()
+	n.resolvedURL = base.String()
+	n.respMtx.Unlock()
+}
+
+// marshal encodes v as JSON, without escaping HTML characters if the
+// reference was created with WithDisableHTMLEscape.
+func (n *NestAPI) marshal(v interface{}) ([]byte, error) {
+	if !n.opts.disableHTMLEscape {
+		return json.Marshal(v)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
 		return nil, err
 	}
+	// Encode terminates the value with a newline
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// unmarshal decodes the JSON in b into v, decoding numbers as
+// json.Number if the reference was created with WithUseNumber.
+func (n *NestAPI) unmarshal(b []byte, v interface{}) error {
+	if n.opts.useNumber {
+		return decodeUseNumber(b, v)
+	}
+	return json.Unmarshal(b, v)
+}
 
-	if resp.StatusCode/200 != 1 {
-		apiError := &APIError{}
-		err := json.Unmarshal(respBody, &apiError)
+// decodeBody returns the response body, decompressing it if the
+// server sent it gzip encoded.
+func decodeBody(resp *http.Response) (io.Reader, error) {
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		return gzip.NewReader(resp.Body)
+	}
+	return resp.Body, nil
+}
 
-		if err != nil {
-			return nil, &APIError{
-				Type:    "nestapi#json-parse",
-				Message: "Unable to parse Nest API JSON",
-			}
+func (n *NestAPI) logf(format string, v ...interface{}) {
+	if n.Logger != nil {
+		n.Logger.Printf(format, v...)
+		return
+	}
+	log.Printf(format, v...)
+}
+
+// newAPIError returns the APIError of a response with the given
+// unsuccessful status and body.
+func newAPIError(status int, body []byte) *APIError {
+	var apiError APIError
+	if err := json.Unmarshal(body, &apiError); err != nil {
+		return &APIError{
+			Type:       "nestapi#json-parse",
+			Message:    "Unable to parse Nest API JSON",
+			StatusCode: status,
 		}
+	}
+
+	apiError.StatusCode = status
+	return &apiError
+}
 
-		return nil, apiError
+// isPermanent reports whether err is an APIError for a client error
+// that retrying won't fix, i.e. a 4xx other than 429 Too Many Requests.
+func isPermanent(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
 	}
-	return respBody, nil
+	return apiErr.StatusCode >= 400 && apiErr.StatusCode < 500 &&
+		apiErr.StatusCode != http.StatusTooManyRequests
 }
 
-func apiTimeoutError() *APIError {
+func apiTimeoutError(cause error) *APIError {
 	return &APIError{
 		Type:    "nestapi#timeout",
 		Message: "Timeout contacting Nest Server",
+		cause:   cause,
 	}
 }
+
+// timeoutError returns a timeout APIError if err was caused by a
+// timeout or an exceeded deadline, and err itself otherwise.
+func timeoutError(err error) error {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return apiTimeoutError(err)
+	}
+	return err
+}
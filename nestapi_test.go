@@ -0,0 +1,596 @@
+package nestapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testServer is an in-memory stand-in for the NestAPI REST server.
+type testServer struct {
+	*httptest.Server
+
+	// NoServerValues rejects writes of server values with a 400
+	NoServerValues bool
+
+	mtx    sync.Mutex
+	data   interface{}
+	pushID int
+}
+
+func newTestServer(t *testing.T) *testServer {
+	s := &testServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Get returns the value stored at path.
+func (s *testServer) Get(path string) interface{} {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return getAt(s.data, splitKeys(path))
+}
+
+// Set stores v, which is round-tripped through JSON, at path.
+func (s *testServer) Set(path string, v interface{}) {
+	b, _ := json.Marshal(v)
+	var data interface{}
+	decodeUseNumber(b, &data)
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.data = setAt(s.data, splitKeys(path), data)
+}
+
+func (s *testServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	keys := splitKeys(strings.TrimSuffix(r.URL.Path, ".json"))
+	query := r.URL.Query()
+
+	var body interface{}
+	if r.Method != "GET" && r.Method != "DELETE" {
+		if err := decodeUseNumber(readAll(r), &body); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid data; couldn't parse JSON object.")
+			return
+		}
+	}
+
+	current := getAt(s.data, keys)
+	if match := r.Header.Get("if-match"); match != "" && match != etagOf(current) {
+		w.Header().Set("ETag", etagOf(current))
+		w.WriteHeader(http.StatusPreconditionFailed)
+		json.NewEncoder(w).Encode(current)
+		return
+	}
+
+	if match := r.Header.Get("if-none-match"); r.Method == "GET" && match == etagOf(current) {
+		w.Header().Set("ETag", match)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	var resp interface{}
+	switch r.Method {
+	case "GET":
+		resp = current
+		if m, ok := current.(map[string]interface{}); ok && query.Get(shallowParam) == "true" {
+			keys := map[string]interface{}{}
+			for k := range m {
+				keys[k] = true
+			}
+			resp = keys
+		}
+	case "PUT":
+		v, ok := s.resolve(current, body)
+		if !ok {
+			writeError(w, http.StatusBadRequest, "Server values are not supported.")
+			return
+		}
+		s.data = setAt(s.data, keys, v)
+		resp = v
+	case "PATCH":
+		children, ok := body.(map[string]interface{})
+		if !ok {
+			writeError(w, http.StatusBadRequest, "Invalid data; couldn't parse JSON object.")
+			return
+		}
+		for k, child := range children {
+			path := append(keys[:len(keys):len(keys)], splitKeys(k)...)
+			v, ok := s.resolve(getAt(s.data, path), child)
+			if !ok {
+				writeError(w, http.StatusBadRequest, "Server values are not supported.")
+				return
+			}
+			s.data = setAt(s.data, path, v)
+		}
+		resp = body
+	case "POST":
+		s.pushID++
+		name := fmt.Sprintf("-K%04d", s.pushID)
+		s.data = setAt(s.data, append(keys, name), body)
+		resp = map[string]interface{}{"name": name}
+	case "DELETE":
+		s.data = setAt(s.data, keys, nil)
+	}
+
+	if r.Header.Get("X-Firebase-ETag") == "true" {
+		w.Header().Set("ETag", etagOf(getAt(s.data, keys)))
+	}
+	if query.Get(printParam) == "silent" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// resolve replaces the server values in v, given the current value.
+func (s *testServer) resolve(current, v interface{}) (interface{}, bool) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return v, true
+	}
+	sv, ok := m[".sv"]
+	if !ok {
+		return v, true
+	}
+	if s.NoServerValues {
+		return nil, false
+	}
+
+	switch sv := sv.(type) {
+	case string:
+		return json.Number("1500000000000"), true
+	case map[string]interface{}:
+		delta, _ := sv["increment"].(json.Number).Float64()
+		base := 0.0
+		if n, ok := current.(json.Number); ok {
+			base, _ = n.Float64()
+		}
+		return json.Number(fmt.Sprint(base + delta)), true
+	}
+	return nil, false
+}
+
+func readAll(r *http.Request) []byte {
+	var buf bytes.Buffer
+	buf.ReadFrom(r.Body)
+	return buf.Bytes()
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+func etagOf(v interface{}) string {
+	b, _ := json.Marshal(v)
+	sum := sha1.Sum(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func splitKeys(path string) []string {
+	var keys []string
+	for _, k := range strings.Split(path, "/") {
+		if k != "" {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func getAt(node interface{}, keys []string) interface{} {
+	for _, k := range keys {
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		node = m[k]
+	}
+	return node
+}
+
+// setAt returns node with the value at keys replaced by v, removing
+// the value if v is nil along with any parents left empty.
+func setAt(node interface{}, keys []string, v interface{}) interface{} {
+	if len(keys) == 0 {
+		return v
+	}
+
+	m, ok := node.(map[string]interface{})
+	if !ok {
+		m = map[string]interface{}{}
+	}
+	if child := setAt(m[keys[0]], keys[1:], v); child != nil {
+		m[keys[0]] = child
+	} else {
+		delete(m, keys[0])
+	}
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
+
+func TestUpdate(t *testing.T) {
+	server := newTestServer(t)
+	n := New(server.URL, nil)
+
+	require.NoError(t, n.Set(map[string]interface{}{"a": 1, "b": 2}))
+	require.NoError(t, n.Update(map[string]interface{}{"b": 3}))
+
+	var v map[string]interface{}
+	require.NoError(t, n.Get(&v))
+	assert.Equal(t, map[string]interface{}{"a": float64(1), "b": float64(3)}, v)
+}
+
+func TestRemove(t *testing.T) {
+	server := newTestServer(t)
+	n := New(server.URL, nil).Child("stale/node")
+
+	require.NoError(t, n.Set("foo"))
+	require.NoError(t, n.Remove())
+
+	var v interface{}
+	require.NoError(t, n.Get(&v))
+	assert.Nil(t, v)
+	assert.Nil(t, server.Get("/stale"))
+}
+
+func TestSetSilent(t *testing.T) {
+	server := newTestServer(t)
+	n := New(server.URL, nil).Silent()
+
+	var status int
+	n.OnResponse = func(method, url string, s int, dur time.Duration, err error) {
+		status = s
+	}
+
+	require.NoError(t, n.Set("foo"))
+	assert.Equal(t, http.StatusNoContent, status)
+	assert.Equal(t, "foo", server.Get("/"))
+}
+
+// redirectServer returns a server that redirects every request to the
+// same path and query on target with a 307.
+func redirectServer(t *testing.T, target string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target+r.URL.RequestURI(), http.StatusTemporaryRedirect)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRedirectConcurrent(t *testing.T) {
+	server := newTestServer(t)
+	redirect := redirectServer(t, server.URL)
+	n := New(redirect.URL, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, n.Child(fmt.Sprint(i)).Set(i))
+		}(i)
+		go func() {
+			defer wg.Done()
+			var v interface{}
+			assert.NoError(t, n.Get(&v))
+			_ = n.String()
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, redirect.URL+"/.json", n.String())
+	assert.Equal(t, json.Number("9"), server.Get("/9"))
+	assert.Equal(t, server.URL, n.ResolvedURL())
+}
+
+func TestKey(t *testing.T) {
+	n := New("https://example.com", nil)
+	assert.Equal(t, "", n.Key())
+	assert.Equal(t, "a", n.Child("a").Key())
+	assert.Equal(t, "-Kxxxx", n.Child("a/b/-Kxxxx").Key())
+}
+
+func TestRoot(t *testing.T) {
+	client := &http.Client{}
+	n := New("https://example.com", client)
+	n.Auth("token")
+
+	root := n.Child("a/b/c").Root()
+	assert.Equal(t, "https://example.com/.json?auth=token", root.String())
+	assert.Same(t, client, root.Client())
+}
+
+func TestSetClient(t *testing.T) {
+	n := New("https://example.com", nil)
+	child := n.Child("a")
+
+	client := &http.Client{}
+	n.SetClient(client)
+	assert.Same(t, client, n.Client())
+	assert.Same(t, client, n.Child("b").Client())
+	assert.NotSame(t, client, child.Client())
+}
+
+func TestUpdateNilDeletes(t *testing.T) {
+	server := newTestServer(t)
+	n := New(server.URL, nil)
+
+	require.NoError(t, n.Set(map[string]interface{}{"a": 1}))
+	require.NoError(t, n.Update(map[string]interface{}{"a": nil, "b": 2}))
+	assert.Equal(t, map[string]interface{}{"b": json.Number("2")}, server.Get("/"))
+}
+
+func TestUpdateMulti(t *testing.T) {
+	server := newTestServer(t)
+	server.Set("/users/u1", map[string]interface{}{"name": "a", "age": 1})
+	n := New(server.URL, nil)
+
+	var requests int
+	n.OnResponse = func(method, url string, status int, dur time.Duration, err error) {
+		requests++
+	}
+
+	require.NoError(t, n.UpdateMulti(map[string]interface{}{
+		"users/u1/name": "x",
+		"users/u2/name": "y",
+	}))
+	assert.Equal(t, 1, requests)
+	assert.Equal(t, map[string]interface{}{
+		"u1": map[string]interface{}{"name": "x", "age": json.Number("1")},
+		"u2": map[string]interface{}{"name": "y"},
+	}, server.Get("/users"))
+}
+
+func TestExists(t *testing.T) {
+	server := newTestServer(t)
+	server.Set("/a", map[string]interface{}{"b": 1})
+	n := New(server.URL, nil)
+
+	ok, err := n.Child("a").Exists()
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = n.Child("missing").Exists()
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	denied := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusUnauthorized, "Permission denied")
+	}))
+	defer denied.Close()
+
+	ok, err = New(denied.URL, nil).Exists()
+	assert.True(t, IsUnauthorized(err))
+	assert.False(t, ok)
+}
+
+func TestSetHeader(t *testing.T) {
+	var mtx sync.Mutex
+	headers := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		headers[r.Method] = r.Header.Get("X-Api-Key")
+		mtx.Unlock()
+
+		if r.Method == "GET" {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "event: put\ndata: {\"path\":\"/\",\"data\":null}\n\n")
+			return
+		}
+		w.Write([]byte(`"foo"`))
+	}))
+	defer server.Close()
+
+	n := New(server.URL, nil)
+	n.SetHeader("X-Api-Key", "secret")
+	child := n.Child("a")
+	require.NoError(t, child.Set("foo"))
+
+	notifications := make(chan Event)
+	require.NoError(t, child.Watch(notifications))
+	for range notifications {
+	}
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	assert.Equal(t, map[string]string{"PUT": "secret", "GET": "secret"}, headers)
+}
+
+func TestRemoveChildren(t *testing.T) {
+	server := newTestServer(t)
+	server.Set("/list", map[string]interface{}{"a": 1, "b": 2, "c": 3})
+	n := New(server.URL, nil).Child("list")
+
+	require.NoError(t, n.RemoveChildren([]string{"a", "c"}))
+	assert.Equal(t, map[string]interface{}{"b": json.Number("2")}, server.Get("/list"))
+}
+
+func TestRedirectHeaders(t *testing.T) {
+	for name, client := range map[string]*http.Client{
+		"client":    nil,
+		"no follow": {CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var header http.Header
+			target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				header = r.Header
+				w.Write([]byte(`"ok"`))
+			}))
+			defer target.Close()
+			redirect := redirectServer(t, target.URL)
+
+			n := New(redirect.URL, client)
+			n.AuthBearer("token")
+			n.SetHeader("X-Api-Key", "secret")
+
+			var v string
+			require.NoError(t, n.Get(&v))
+			require.NotNil(t, header)
+			assert.Equal(t, "Bearer token", header.Get("Authorization"))
+			assert.Equal(t, "secret", header.Get("X-Api-Key"))
+		})
+	}
+}
+
+func TestContextCanceledAndDeadline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	n := New(server.URL, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	var v interface{}
+	err := n.GetWithContext(ctx, &v)
+	assert.True(t, errors.Is(err, context.Canceled), "%v", err)
+	var apiErr *APIError
+	assert.False(t, errors.As(err, &apiErr), "%v", err)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = n.GetWithContext(ctx, &v)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "%v", err)
+	require.True(t, errors.As(err, &apiErr), "%v", err)
+	assert.Equal(t, "timeout", apiErr.Reason())
+}
+
+func TestSetChildren(t *testing.T) {
+	server := newTestServer(t)
+	server.Set("/", map[string]interface{}{"a": 1, "b": 2})
+	n := New(server.URL, nil)
+
+	require.NoError(t, n.SetChildren(map[string]interface{}{
+		"b": map[string]interface{}{"c": 3},
+		"d": 4,
+	}))
+	assert.Equal(t, map[string]interface{}{
+		"a": json.Number("1"),
+		"b": map[string]interface{}{"c": json.Number("3")},
+		"d": json.Number("4"),
+	}, server.Get("/"))
+}
+
+func TestChildEscaping(t *testing.T) {
+	n := New("https://example.com", nil)
+	assert.Equal(t, "https://example.com/my%20key/.json", n.Child("my key").String())
+	assert.Equal(t, "https://example.com/a%3Fb/c%25d/.json", n.Child("a?b/c%d").String())
+	assert.Equal(t, "https://example.com/a/b/.json", n.Child("/a//b/").String())
+
+	server := newTestServer(t)
+	require.NoError(t, New(server.URL, nil).Child("my key").Set(1))
+	assert.Equal(t, json.Number("1"), server.Get("/my key"))
+}
+
+func TestTreat404AsNil(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "Not found")
+	}))
+	defer server.Close()
+
+	v := "kept"
+	err := New(server.URL, nil).Get(&v)
+	assert.True(t, IsNotFound(err), "%v", err)
+
+	n := New(server.URL, nil, WithTreat404AsNil())
+	require.NoError(t, n.Get(&v))
+	assert.Equal(t, "kept", v)
+
+	// a write that wasn't applied still fails
+	assert.True(t, IsNotFound(n.Set(1)))
+	assert.True(t, IsNotFound(n.Update(map[string]interface{}{"a": 1})))
+	assert.True(t, IsNotFound(n.Remove()))
+	_, err = n.Push(1)
+	assert.True(t, IsNotFound(err))
+}
+
+func TestPath(t *testing.T) {
+	n := New("https://example.com", nil)
+	assert.Equal(t, "/", n.Path())
+	assert.Equal(t, "/a/b", n.Child("a/b").Path())
+	assert.Equal(t, "/a/b", n.Child("a").Child("b").OrderBy("c").Path())
+	assert.Equal(t, "/", n.Child("a/b").Root().Path())
+}
+
+func TestPush(t *testing.T) {
+	server := newTestServer(t)
+	n := New(server.URL, nil).Child("logs")
+
+	key, err := n.Push("entry")
+	require.NoError(t, err)
+	assert.Equal(t, "-K0001", key)
+	assert.Equal(t, "entry", server.Get("/logs/"+key))
+
+	_, err = n.Child("a$b").Push("entry")
+	assert.True(t, errors.Is(err, ErrInvalidKey), "%v", err)
+}
+
+func TestPushBadResponse(t *testing.T) {
+	for name, body := range map[string]string{
+		"empty":    "",
+		"nameless": `{"id":"-K0001"}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(body))
+			}))
+			defer server.Close()
+
+			key, err := New(server.URL, nil).Push("entry")
+			assert.Error(t, err)
+			assert.Empty(t, key)
+		})
+	}
+}
+
+func TestGetStreamWithContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"a":`))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	var v interface{}
+	err := New(server.URL, nil).GetStreamWithContext(ctx, &v)
+	assert.True(t, errors.Is(err, context.Canceled), "%v", err)
+}
+
+func TestGetFieldsWithContext(t *testing.T) {
+	server := newTestServer(t)
+	server.Set("/", map[string]interface{}{"a": 1, "b": map[string]interface{}{"c": "d"}, "e": 2})
+	n := New(server.URL, nil)
+
+	out := map[string]interface{}{}
+	require.NoError(t, n.GetFieldsWithContext(context.Background(), []string{"a", "b/c"}, out))
+	assert.Equal(t, map[string]interface{}{"a": float64(1), "b/c": "d"}, out)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	out = map[string]interface{}{}
+	err := n.GetFieldsWithContext(ctx, []string{"a", "e"}, out)
+	assert.True(t, errors.Is(err, context.Canceled), "%v", err)
+	assert.Empty(t, out)
+}
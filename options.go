@@ -0,0 +1,248 @@
+package nestapi
+
+import (
+	"crypto/tls"
+	"net/http"
+	_url "net/url"
+	"time"
+)
+
+// Option configures a NestAPI reference created by New.
+type Option func(*options)
+
+type options struct {
+	dialerTimeout         time.Duration
+	responseHeaderTimeout time.Duration
+	keepAliveTimeout      time.Duration
+	requestTimeout        time.Duration
+	proxy                 func(*http.Request) (*_url.URL, error)
+	tlsConfig             *tls.Config
+	insecureSkipVerify    bool
+
+	compression  bool
+	useNumber    bool
+	eventBuffer  int
+	watchTimeout time.Duration
+	maxRedirects int
+	pathSuffix   string
+
+	disableHTMLEscape bool
+	skipBadFrames     bool
+	treat404AsNil     bool
+	reauthOnRevoke    bool
+}
+
+// defaultPathSuffix is appended to the path of a reference to build
+// the URL of the Firebase REST API.
+const defaultPathSuffix = "/.json"
+
+// defaultOptions returns the options built from the package-level
+// timeout durations.
+func defaultOptions() options {
+	return options{
+		dialerTimeout:         DialerTimeoutDuration,
+		responseHeaderTimeout: ResponseHeaderTimeoutDuration,
+		keepAliveTimeout:      KeepAliveTimeoutDuration,
+		proxy:                 http.ProxyFromEnvironment,
+		tlsConfig:             &tls.Config{MinVersion: tls.VersionTLS12},
+		watchTimeout:          KeepAliveTimeoutDuration,
+		maxRedirects:          defaultRedirectLimit,
+		pathSuffix:            defaultPathSuffix,
+	}
+}
+
+// WithTimeout sets both the dialer and the response header timeout of
+// the transport built by New. It has no effect when a client is given.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.dialerTimeout = d
+		o.responseHeaderTimeout = d
+	}
+}
+
+// WithDialerTimeout sets the dialer timeout of the transport built by
+// New, overriding DialerTimeoutDuration. It has no effect when a
+// client is given.
+func WithDialerTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.dialerTimeout = d
+	}
+}
+
+// WithConnectTimeout sets how long the transport built by New waits for
+// a connection to be established, like WithDialerTimeout. It has no
+// effect when a client is given.
+func WithConnectTimeout(d time.Duration) Option {
+	return WithDialerTimeout(d)
+}
+
+// WithRequestTimeout sets the Timeout of the client built by New, which
+// bounds the whole of each request, from connecting to reading the last
+// byte of the response. It is unset by default. The response header
+// timeout still applies within it, so a request that gets no response
+// headers in time fails with whichever timeout is shorter. Watches are
+// not subject to it, so their connections can stay open indefinitely.
+// It has no effect when a client is given.
+func WithRequestTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.requestTimeout = d
+	}
+}
+
+// WithResponseHeaderTimeout sets the response header timeout of the
+// transport built by New, overriding ResponseHeaderTimeoutDuration.
+// It has no effect when a client is given.
+func WithResponseHeaderTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.responseHeaderTimeout = d
+	}
+}
+
+// WithKeepAliveTimeout sets the keep-alive period of the transport
+// built by New, overriding KeepAliveTimeoutDuration. It has no effect
+// when a client is given.
+func WithKeepAliveTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.keepAliveTimeout = d
+	}
+}
+
+// WithProxy sends the requests of the transport built by New through
+// the given proxy URL. Without it, the proxy is taken from the
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables. It has no
+// effect when a client is given.
+func WithProxy(url string) Option {
+	u, err := _url.Parse(url)
+	return func(o *options) {
+		o.proxy = func(*http.Request) (*_url.URL, error) {
+			return u, err
+		}
+	}
+}
+
+// WithTLSConfig sets the TLS configuration of the transport built by
+// New, e.g. to trust a custom CA bundle. Without it, TLS 1.2 is the
+// minimum version accepted. It has no effect when a client is given.
+func WithTLSConfig(c *tls.Config) Option {
+	return func(o *options) {
+		o.tlsConfig = c
+	}
+}
+
+// WithInsecureSkipVerify disables the verification of the server's
+// certificate by the transport built by New, e.g. for a local emulator
+// with a self-signed certificate. It applies on top of WithTLSConfig.
+//
+// WARNING: this makes the connection open to man-in-the-middle attacks.
+// Only use it for development, never in production.
+func WithInsecureSkipVerify() Option {
+	return func(o *options) {
+		o.insecureSkipVerify = true
+	}
+}
+
+// WithCompression explicitly requests gzip encoded responses for reads
+// and watches, which are decompressed transparently, even when the
+// client given to New has compression disabled. The transport built by
+// New already requests them for reads on its own. Only use it with
+// servers that support gzip encoding.
+func WithCompression() Option {
+	return func(o *options) {
+		o.compression = true
+	}
+}
+
+// WithUseNumber decodes numbers as json.Number rather than float64 when
+// reading into an interface{}, preserving the precision of large
+// integers. It applies to Get and to the values of watched events.
+func WithUseNumber() Option {
+	return func(o *options) {
+		o.useNumber = true
+	}
+}
+
+// WithEventBuffer queues up to size events received while watching,
+// so that a slow consumer doesn't stall reading the connection and
+// miss keep-alives. When the queue is full the oldest queued event is
+// dropped to make room, so a consumer that falls behind by more than
+// size events loses the oldest of them.
+func WithEventBuffer(size int) Option {
+	return func(o *options) {
+		o.eventBuffer = size
+	}
+}
+
+// WithWatchTimeout sets how long a watch waits for an event, including
+// the keep-alive events the server sends periodically, before it
+// considers the connection dead. The connection is then closed with an
+// EventTypeError event, or re-established by WatchWithReconnect. Only
+// the time spent waiting for the server counts, not the time the
+// consumer takes to receive an event. It defaults to
+// KeepAliveTimeoutDuration; zero disables the check.
+func WithWatchTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.watchTimeout = d
+	}
+}
+
+// WithMaxRedirects sets the maximum number of consecutive redirects a
+// request follows before failing, 30 by default. For a client given to
+// New, it only applies to the 307 redirects that NestAPI follows itself.
+func WithMaxRedirects(max int) Option {
+	return func(o *options) {
+		o.maxRedirects = max
+	}
+}
+
+// WithPathSuffix sets the suffix appended to the path of the reference
+// to build the URL of its requests and watches, "/.json" by default.
+// Use it with emulators and gateways that expect a different path
+// convention, e.g. "" for plain paths.
+func WithPathSuffix(suffix string) Option {
+	return func(o *options) {
+		o.pathSuffix = suffix
+	}
+}
+
+// WithDisableHTMLEscape writes the characters <, > and & in strings as
+// is, rather than escaped as \u003c, \u003e and \u0026 as json.Marshal
+// does.
+func WithDisableHTMLEscape() Option {
+	return func(o *options) {
+		o.disableHTMLEscape = true
+	}
+}
+
+// WithSkipBadFrames keeps a watch going when a put or patch event can't
+// be parsed, e.g. because its data was truncated, sending an
+// EventTypeBadFrame event in its place. Without it, such an event ends
+// the connection with an EventTypeError event.
+func WithSkipBadFrames() Option {
+	return func(o *options) {
+		o.skipBadFrames = true
+	}
+}
+
+// WithTreat404AsNil treats a 404 Not Found response to a read, as some
+// proxies return for a missing value, like the null value the server
+// returns for it, so that e.g. Get succeeds without setting anything.
+// Without it, or for a write, such a response is an APIError for which
+// IsNotFound reports true.
+func WithTreat404AsNil() Option {
+	return func(o *options) {
+		o.treat404AsNil = true
+	}
+}
+
+// WithReauthOnRevoke re-establishes a watch whose auth was revoked with
+// a fresh token from the provider set with SetAuthProvider, rather than
+// ending it. The EventTypeAuthRevoked event is then replaced by an
+// EventTypeReconnecting event whose Data is the revocation error. The
+// watch ends as usual, with the EventTypeAuthRevoked event, if no
+// provider is set; if the provider returns an error or the connection
+// can't be re-established, it ends and LastWatchError returns why.
+func WithReauthOnRevoke() Option {
+	return func(o *options) {
+		o.reauthOnRevoke = true
+	}
+}
@@ -0,0 +1,191 @@
+package nestapi
+
+import (
+	"compress/gzip"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gzipServer returns a server that gzips its response to clients that
+// accept it, and reports whether the last request did.
+func gzipServer(t *testing.T, body string) (*httptest.Server, *bool) {
+	gzipped := new(bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*gzipped = r.Header.Get("Accept-Encoding") == "gzip"
+		if !*gzipped {
+			w.Write([]byte(body))
+			return
+		}
+
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write([]byte(body))
+		gz.Close()
+	}))
+	t.Cleanup(server.Close)
+	return server, gzipped
+}
+
+func TestWithCompression(t *testing.T) {
+	server, gzipped := gzipServer(t, `{"foo":"bar"}`)
+	noGzip := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+
+	var v map[string]interface{}
+	require.NoError(t, New(server.URL, noGzip, WithCompression()).Get(&v))
+	assert.True(t, *gzipped)
+	assert.Equal(t, map[string]interface{}{"foo": "bar"}, v)
+
+	v = nil
+	require.NoError(t, New(server.URL, noGzip).Get(&v))
+	assert.False(t, *gzipped)
+	assert.Equal(t, map[string]interface{}{"foo": "bar"}, v)
+
+	// the transport built by New asks for gzip by default
+	v = nil
+	require.NoError(t, New(server.URL, nil).Get(&v))
+	assert.True(t, *gzipped)
+	assert.Equal(t, map[string]interface{}{"foo": "bar"}, v)
+}
+
+func TestWithCompressionWatch(t *testing.T) {
+	server, gzipped := gzipServer(t, "event: put\ndata: {\"path\":\"/\",\"data\":1}\n\n")
+
+	notifications := make(chan Event)
+	require.NoError(t, New(server.URL, nil, WithCompression()).Watch(notifications))
+
+	events := collect(t, notifications)
+	assert.True(t, *gzipped)
+	require.NotEmpty(t, events)
+	assert.Equal(t, EventTypePut, events[0].Type)
+	assert.Equal(t, float64(1), events[0].Data)
+}
+
+func TestWithUseNumber(t *testing.T) {
+	server := newTestServer(t)
+	n := New(server.URL, nil, WithUseNumber())
+
+	const big int64 = 1<<53 + 1
+	require.NoError(t, n.Set(map[string]int64{"id": big}))
+
+	var v map[string]interface{}
+	require.NoError(t, n.Get(&v))
+	assert.Equal(t, json.Number("9007199254740993"), v["id"])
+}
+
+func TestWithProxy(t *testing.T) {
+	var host string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host = r.URL.Host
+		w.Write([]byte(`"proxied"`))
+	}))
+	defer proxy.Close()
+
+	var v string
+	require.NoError(t, New("http://nest.example.com", nil, WithProxy(proxy.URL)).Get(&v))
+	assert.Equal(t, "proxied", v)
+	assert.Equal(t, "nest.example.com", host)
+}
+
+func TestWithProxyDefault(t *testing.T) {
+	// http.ProxyFromEnvironment reads the environment only once per
+	// process, so check that it is the function used instead.
+	tr := New("http://nest.example.com", nil).Client().Transport.(*http.Transport)
+	assert.Equal(t, reflect.ValueOf(http.ProxyFromEnvironment).Pointer(), reflect.ValueOf(tr.Proxy).Pointer())
+}
+
+func TestWithTLSConfig(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`"secure"`))
+	}))
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	defer server.Close()
+
+	var v string
+	assert.Error(t, New(server.URL, nil).Get(&v))
+
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	require.NoError(t, New(server.URL, nil, WithTLSConfig(&tls.Config{RootCAs: pool})).Get(&v))
+	assert.Equal(t, "secure", v)
+}
+
+func TestTLSMinVersionDefault(t *testing.T) {
+	tr := New("https://example.com", nil).Client().Transport.(*http.Transport)
+	assert.Equal(t, uint16(tls.VersionTLS12), tr.TLSClientConfig.MinVersion)
+}
+
+func TestWithMaxRedirects(t *testing.T) {
+	var requests int32
+	var loop *httptest.Server
+	loop = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		http.Redirect(w, r, loop.URL+r.URL.RequestURI(), http.StatusTemporaryRedirect)
+	}))
+	defer loop.Close()
+
+	var v interface{}
+	assert.Error(t, New(loop.URL, nil, WithMaxRedirects(2)).Get(&v))
+	assert.EqualValues(t, 3, atomic.LoadInt32(&requests))
+
+	server := newTestServer(t)
+	server.Set("/", "ok")
+	redirect := redirectServer(t, server.URL)
+	require.NoError(t, New(redirect.URL, nil, WithMaxRedirects(1)).Get(&v))
+	assert.Equal(t, "ok", v)
+}
+
+func TestWithPathSuffix(t *testing.T) {
+	n := New("https://example.com", nil, WithPathSuffix(".data"))
+	assert.Equal(t, "https://example.com/a/b.data", n.Child("a/b").String())
+	assert.Equal(t, "https://example.com/.json", New("https://example.com", nil).String())
+
+	server := newTestServer(t)
+	require.NoError(t, New(server.URL, nil, WithPathSuffix("")).Child("a").Set(1))
+	assert.Equal(t, json.Number("1"), server.Get("/a"))
+}
+
+func TestWithDisableHTMLEscape(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body = string(readAll(r))
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	require.NoError(t, New(server.URL, nil).Set("<a&b>"))
+	assert.Equal(t, `"\u003ca\u0026b\u003e"`, strings.TrimSpace(body))
+
+	require.NoError(t, New(server.URL, nil, WithDisableHTMLEscape()).Set("<a&b>"))
+	assert.Equal(t, `"<a&b>"`, strings.TrimSpace(body))
+}
+
+func TestWithInsecureSkipVerify(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`"insecure"`))
+	}))
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	defer server.Close()
+
+	var v string
+	assert.Error(t, New(server.URL, nil, WithTLSConfig(&tls.Config{MinVersion: tls.VersionTLS12})).Get(&v))
+
+	n := New(server.URL, nil, WithTLSConfig(&tls.Config{MinVersion: tls.VersionTLS12}), WithInsecureSkipVerify())
+	require.NoError(t, n.Get(&v))
+	assert.Equal(t, "insecure", v)
+
+	config := n.Client().Transport.(*http.Transport).TLSClientConfig
+	assert.True(t, config.InsecureSkipVerify)
+	assert.Equal(t, uint16(tls.VersionTLS12), config.MinVersion)
+}
@@ -0,0 +1,178 @@
+package nestapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	_url "net/url"
+	"strconv"
+	"time"
+)
+
+// bounds of the server side query timeout
+const (
+	minQueryTimeout = time.Millisecond
+	maxQueryTimeout = 15 * time.Minute
+)
+
+// Shallow returns a new NestAPI reference that only retrieves the
+// keys of the children at the reference, each with the value true.
+//
+// Shallow cannot be combined with OrderBy.
+func (n *NestAPI) Shallow() *NestAPI {
+	c := n.copy()
+	c.params.Set(shallowParam, "true")
+	return c
+}
+
+// OrderBy returns a new NestAPI reference that orders the results
+// by the given child key. The special keys "$key", "$value" and
+// "$priority" order by the child's key, value and priority.
+func (n *NestAPI) OrderBy(key string) *NestAPI {
+	c := n.copy()
+	c.params.Set(orderByParam, quote(key))
+	return c
+}
+
+// Silent returns a new NestAPI reference whose writes are not
+// echoed back by the server, which replies 204 No Content instead.
+// Silent and Pretty both set the print parameter, so whichever is
+// applied last wins.
+func (n *NestAPI) Silent() *NestAPI {
+	c := n.copy()
+	c.params.Set(printParam, "silent")
+	return c
+}
+
+// Pretty returns a new NestAPI reference whose responses are
+// indented for readability. Pretty and Silent both set the print
+// parameter, so whichever is applied last wins.
+func (n *NestAPI) Pretty() *NestAPI {
+	c := n.copy()
+	c.params.Set(printParam, "pretty")
+	return c
+}
+
+// Export returns a new NestAPI reference whose reads include the
+// priority of each value, in the export format with ".value" and
+// ".priority" keys, so that a tree can be backed up and restored.
+func (n *NestAPI) Export() *NestAPI {
+	c := n.copy()
+	c.params.Set(formatParam, "export")
+	return c
+}
+
+// Download returns a new NestAPI reference whose reads are served as an
+// attachment with the given filename, which the server sets in the
+// Content-Disposition header of the response, e.g. for GetRaw.
+func (n *NestAPI) Download(filename string) *NestAPI {
+	c := n.copy()
+	c.params.Set(downloadParam, filename)
+	return c
+}
+
+// QueryTimeout returns a new NestAPI reference that limits how long
+// the server spends on its reads. This is independent of the client
+// side timeouts. The duration is rounded to the millisecond and must be
+// between 1ms and 15 minutes; otherwise Validate reports an error
+// wrapping ErrInvalidQuery, so the reads and watches of the returned
+// reference fail with it until the query is cleared.
+func (n *NestAPI) QueryTimeout(d time.Duration) *NestAPI {
+	c := n.copy()
+	d = d.Round(time.Millisecond)
+	if d < minQueryTimeout || d > maxQueryTimeout {
+		c.queryErr = fmt.Errorf("%w: query timeout %s is outside %s to %s", ErrInvalidQuery, d, minQueryTimeout, maxQueryTimeout)
+		return c
+	}
+	c.queryErr = nil
+
+	if d%time.Second == 0 {
+		c.params.Set(timeoutParam, strconv.FormatInt(int64(d/time.Second), 10)+"s")
+	} else {
+		c.params.Set(timeoutParam, strconv.FormatInt(int64(d/time.Millisecond), 10)+"ms")
+	}
+	return c
+}
+
+// LimitToFirst returns a new NestAPI reference that only retrieves
+// the first limit children, in the order given by OrderBy.
+// A negative limit removes any previously set limit.
+func (n *NestAPI) LimitToFirst(limit int) *NestAPI {
+	return n.limit(limitToFirstParam, limit)
+}
+
+// LimitToLast returns a new NestAPI reference that only retrieves
+// the last limit children, in the order given by OrderBy.
+// A negative limit removes any previously set limit.
+func (n *NestAPI) LimitToLast(limit int) *NestAPI {
+	return n.limit(limitToLastParam, limit)
+}
+
+func (n *NestAPI) limit(param string, limit int) *NestAPI {
+	c := n.copy()
+	if limit < 0 {
+		c.params.Del(param)
+		return c
+	}
+	c.params.Set(param, strconv.Itoa(limit))
+	return c
+}
+
+// ClearQuery returns a new NestAPI reference without any of the query
+// options set on n, such as OrderBy or Shallow. The auth tokens are kept.
+func (n *NestAPI) ClearQuery() *NestAPI {
+	c := n.copy()
+	c.params = _url.Values{}
+	c.queryErr = nil
+	for _, param := range []string{n.authParamName(), accessTokenParam} {
+		if token := n.params.Get(param); token != "" {
+			c.params.Set(param, token)
+		}
+	}
+	return c
+}
+
+// ErrInvalidQuery is returned, wrapped, when the query options of a
+// reference can't be combined, before a read is sent.
+var ErrInvalidQuery = errors.New("nestapi: invalid query")
+
+// Validate reports whether the query options of the NestAPI reference
+// can be combined, which the server would otherwise reject with a 400
+// Bad Request: Shallow can't be combined with OrderBy or a limit, the
+// limits can't be combined with each other, and a limit requires
+// OrderBy. It also reports an out of range QueryTimeout. Reads and
+// watches are validated before they are sent. The returned error wraps
+// ErrInvalidQuery.
+func (n *NestAPI) Validate() error {
+	if n.queryErr != nil {
+		return n.queryErr
+	}
+
+	has := func(param string) bool {
+		_, ok := n.params[param]
+		return ok
+	}
+
+	if has(shallowParam) {
+		for _, param := range []string{orderByParam, limitToFirstParam, limitToLastParam} {
+			if has(param) {
+				return fmt.Errorf("%w: %s cannot be combined with %s", ErrInvalidQuery, shallowParam, param)
+			}
+		}
+	}
+	if has(limitToFirstParam) && has(limitToLastParam) {
+		return fmt.Errorf("%w: %s cannot be combined with %s", ErrInvalidQuery, limitToFirstParam, limitToLastParam)
+	}
+	for _, param := range []string{limitToFirstParam, limitToLastParam} {
+		if has(param) && !has(orderByParam) {
+			return fmt.Errorf("%w: %s requires %s", ErrInvalidQuery, param, orderByParam)
+		}
+	}
+	return nil
+}
+
+// quote JSON-encodes s, as the API expects for string query values.
+func quote(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
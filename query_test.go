@@ -0,0 +1,123 @@
+package nestapi
+
+import (
+	"errors"
+	_url "net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// queryOf returns the query parameters of the reference's URL.
+func queryOf(t *testing.T, n *NestAPI) _url.Values {
+	u, err := _url.Parse(n.String())
+	require.NoError(t, err)
+	return u.Query()
+}
+
+func TestLimitToFirst(t *testing.T) {
+	n := New("https://example.com", nil).OrderBy("age").LimitToFirst(10)
+	assert.Equal(t, "https://example.com/.json?limitToFirst=10&orderBy=%22age%22", n.String())
+
+	q := queryOf(t, n.LimitToFirst(-1))
+	assert.NotContains(t, q, limitToFirstParam)
+	assert.Equal(t, `"age"`, q.Get(orderByParam))
+}
+
+func TestLimitToLast(t *testing.T) {
+	q := queryOf(t, New("https://example.com", nil).OrderBy("age").LimitToLast(5))
+	assert.Equal(t, "5", q.Get(limitToLastParam))
+	assert.Equal(t, `"age"`, q.Get(orderByParam))
+}
+
+func TestPretty(t *testing.T) {
+	n := New("https://example.com", nil)
+	assert.Equal(t, "pretty", queryOf(t, n.Pretty()).Get(printParam))
+	assert.Equal(t, "pretty", queryOf(t, n.Silent().Pretty()).Get(printParam))
+	assert.Equal(t, "silent", queryOf(t, n.Pretty().Silent()).Get(printParam))
+}
+
+func TestExport(t *testing.T) {
+	assert.Equal(t, "https://example.com/.json?format=export", New("https://example.com", nil).Export().String())
+}
+
+func TestQueryTimeout(t *testing.T) {
+	n := New("https://example.com", nil)
+	assert.Equal(t, "10s", queryOf(t, n.QueryTimeout(10*time.Second)).Get(timeoutParam))
+	assert.Equal(t, "1500ms", queryOf(t, n.QueryTimeout(1500*time.Millisecond)).Get(timeoutParam))
+	assert.Equal(t, "2ms", queryOf(t, n.QueryTimeout(1900*time.Microsecond)).Get(timeoutParam))
+
+	for _, d := range []time.Duration{0, 400 * time.Microsecond, 16 * time.Minute} {
+		var v interface{}
+		err := n.QueryTimeout(d).OrderBy("age").Get(&v)
+		assert.True(t, errors.Is(err, ErrInvalidQuery), "%s: %v", d, err)
+	}
+}
+
+func TestClearQuery(t *testing.T) {
+	n := New("https://example.com", nil).OrderBy("age").LimitToFirst(10).Shallow()
+	assert.Equal(t, "https://example.com/.json", n.ClearQuery().String())
+
+	n.Auth("token")
+	n.AuthAccessToken("access")
+	assert.Equal(t, "https://example.com/.json?access_token=access&auth=token", n.ClearQuery().String())
+}
+
+func TestDownload(t *testing.T) {
+	n := New("https://example.com", nil).Download("my data & more.json")
+	assert.Equal(t, "https://example.com/.json?download=my+data+%26+more.json", n.String())
+	assert.Equal(t, "my data & more.json", queryOf(t, n).Get(downloadParam))
+}
+
+func TestValidate(t *testing.T) {
+	n := New("https://example.com", nil)
+	assert.NoError(t, n.Validate())
+	assert.NoError(t, n.OrderBy("age").LimitToFirst(1).Validate())
+
+	for _, q := range []*NestAPI{
+		n.OrderBy("age").Shallow(),
+		n.LimitToFirst(1),
+		n.OrderBy("age").LimitToFirst(1).LimitToLast(1),
+	} {
+		assert.True(t, errors.Is(q.Validate(), ErrInvalidQuery), q.String())
+	}
+}
+
+func TestShallowIgnoresQuery(t *testing.T) {
+	server := newTestServer(t)
+	server.Set("/", map[string]interface{}{"a": 1, "b": 2})
+	n := New(server.URL, nil).OrderBy("age").LimitToFirst(1)
+
+	ok, err := n.Exists()
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	keys, err := n.ShallowKeys()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, keys)
+
+	count, err := n.Count()
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestQueryTimeoutCleared(t *testing.T) {
+	server := newTestServer(t)
+	server.Set("/a", 1)
+	n := New(server.URL, nil).QueryTimeout(0)
+
+	assert.True(t, errors.Is(n.Validate(), ErrInvalidQuery))
+	assert.True(t, errors.Is(n.Child("a").Root().Validate(), ErrInvalidQuery))
+	assert.NoError(t, n.QueryTimeout(time.Second).Validate())
+	assert.NoError(t, n.Child("a").Set(2))
+
+	var v interface{}
+	require.NoError(t, n.ClearQuery().Child("a").Get(&v))
+	assert.Equal(t, float64(2), v)
+
+	ok, err := n.Exists()
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
@@ -0,0 +1,33 @@
+package nestapi
+
+// Ref is the interface of the commonly used NestAPI operations,
+// for applications that want to substitute a fake in their tests.
+// *NestAPI doesn't implement it directly, since its Child returns
+// *NestAPI; use AsRef to get a Ref for a NestAPI reference.
+type Ref interface {
+	Get(v interface{}) error
+	Set(v interface{}) error
+	Update(v interface{}) error
+	Push(v interface{}) (string, error)
+	Remove() error
+	Child(child string) Ref
+	Watch(notifications chan Event) error
+	StopWatching()
+}
+
+// AsRef returns the NestAPI reference as a Ref.
+func (n *NestAPI) AsRef() Ref {
+	return ref{n}
+}
+
+// ref adapts NestAPI to Ref, whose Child
+// returns the interface rather than *NestAPI.
+type ref struct {
+	*NestAPI
+}
+
+var _ Ref = ref{}
+
+func (r ref) Child(child string) Ref {
+	return ref{r.NestAPI.Child(child)}
+}
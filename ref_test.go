@@ -0,0 +1,17 @@
+package nestapi
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAsRef(t *testing.T) {
+	server := newTestServer(t)
+
+	var r Ref = New(server.URL, nil).AsRef()
+	require.NoError(t, r.Child("a").Child("b").Set(1))
+	assert.Equal(t, json.Number("1"), server.Get("/a/b"))
+}
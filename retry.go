@@ -0,0 +1,156 @@
+package nestapi
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxBackoffShift caps the exponential growth of the retry delay.
+const maxBackoffShift = 16
+
+// RetryConfig configures how requests are retried when the Nest API
+// responds with a transient error (429, 500, 502, 503 or 504).
+type RetryConfig struct {
+	// Max is the maximum number of times a request is retried.
+	// Zero disables retries.
+	Max int
+	// BaseDelay is the delay before the first retry. It doubles on
+	// every following retry, with jitter applied. A Retry-After header
+	// on the response takes precedence.
+	BaseDelay time.Duration
+	// RetryNonIdempotent allows POST requests (Push) to be retried,
+	// which may create duplicate children.
+	RetryNonIdempotent bool
+}
+
+func (r RetryConfig) shouldRetry(method string, err error, attempt int) bool {
+	if attempt >= r.Max {
+		return false
+	}
+	if method == "POST" && !r.RetryNonIdempotent {
+		return false
+	}
+
+	apiErr, ok := err.(*APIError)
+	if !ok {
+		return false
+	}
+
+	switch apiErr.StatusCode {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func (r RetryConfig) delay(attempt int, header http.Header) time.Duration {
+	if d, ok := retryAfter(header); ok {
+		return d
+	}
+
+	if attempt > maxBackoffShift {
+		attempt = maxBackoffShift
+	}
+	d := r.BaseDelay << uint(attempt)
+	if d <= 0 {
+		return 0
+	}
+
+	// jitter over the upper half of the window
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryAfter parses the Retry-After header, which is either a number
+// of seconds or an HTTP date.
+func retryAfter(header http.Header) (time.Duration, bool) {
+	v := header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(v); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// RateLimit holds the rate limiting information sent by the server.
+type RateLimit struct {
+	// RetryAfter is how long the server asked to wait before
+	// retrying, or zero if it didn't.
+	RetryAfter time.Duration
+	// Limit and Remaining are taken from the X-RateLimit-Limit and
+	// X-RateLimit-Remaining headers, or -1 when absent.
+	Limit     int
+	Remaining int
+	// Reset is taken from the X-RateLimit-Reset header, in Unix
+	// seconds, or the zero time when absent.
+	Reset time.Time
+	// Header holds the Retry-After and X-RateLimit-* headers verbatim.
+	Header http.Header
+}
+
+// LastRateLimit returns the rate limiting information of the last
+// response that carried any, or nil if none did.
+func (n *NestAPI) LastRateLimit() *RateLimit {
+	n.respMtx.Lock()
+	defer n.respMtx.Unlock()
+	return n.rateLimit
+}
+
+func (n *NestAPI) recordRateLimit(header http.Header) {
+	rl := parseRateLimit(header)
+	if rl == nil {
+		return
+	}
+
+	n.respMtx.Lock()
+	n.rateLimit = rl
+	n.respMtx.Unlock()
+}
+
+func parseRateLimit(header http.Header) *RateLimit {
+	h := http.Header{}
+	for k, v := range header {
+		if k == "Retry-After" || strings.HasPrefix(k, "X-Ratelimit-") {
+			h[k] = v
+		}
+	}
+	if len(h) == 0 {
+		return nil
+	}
+
+	rl := &RateLimit{
+		Limit:     headerInt(h, "X-Ratelimit-Limit"),
+		Remaining: headerInt(h, "X-Ratelimit-Remaining"),
+		Header:    h,
+	}
+	rl.RetryAfter, _ = retryAfter(h)
+	if secs := headerInt(h, "X-Ratelimit-Reset"); secs >= 0 {
+		rl.Reset = time.Unix(int64(secs), 0)
+	}
+	return rl
+}
+
+func headerInt(h http.Header, key string) int {
+	v, err := strconv.Atoi(h.Get(key))
+	if err != nil {
+		return -1
+	}
+	return v
+}
@@ -0,0 +1,86 @@
+package nestapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// statusServer returns a server that answers with the given statuses in
+// turn, then with 200, and counts the requests it receives.
+func statusServer(t *testing.T, header http.Header, statuses ...int) (*httptest.Server, *int32) {
+	hits := new(int32)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i := int(atomic.AddInt32(hits, 1)) - 1
+		if i < len(statuses) {
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+			writeError(w, statuses[i], http.StatusText(statuses[i]))
+			return
+		}
+		w.Write([]byte(`{"name":"-K0001"}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, hits
+}
+
+func TestRetry(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		config   RetryConfig
+		method   string
+		statuses []int
+		header   http.Header
+		ok       bool
+		hits     int32
+	}{
+		{"recovers", RetryConfig{Max: 3}, "GET", []int{503, 503}, nil, true, 3},
+		{"rate limited", RetryConfig{Max: 3}, "GET", []int{429, 500, 502, 504}, nil, false, 4},
+		{"gives up", RetryConfig{Max: 2}, "GET", []int{503, 503, 503}, nil, false, 3},
+		{"disabled", RetryConfig{}, "GET", []int{503}, nil, false, 1},
+		{"permanent", RetryConfig{Max: 3}, "GET", []int{400}, nil, false, 1},
+		{"push", RetryConfig{Max: 3}, "POST", []int{503}, nil, false, 1},
+		{"push retried", RetryConfig{Max: 3, RetryNonIdempotent: true}, "POST", []int{503}, nil, true, 2},
+		{"retry after", RetryConfig{Max: 1, BaseDelay: time.Hour}, "PUT", []int{503}, http.Header{"Retry-After": {"0"}}, true, 2},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			server, hits := statusServer(t, tt.header, tt.statuses...)
+			n := New(server.URL, nil)
+			n.RetryConfig = tt.config
+
+			var err error
+			switch tt.method {
+			case "GET":
+				var v interface{}
+				err = n.Get(&v)
+			case "PUT":
+				err = n.Set(1)
+			case "POST":
+				_, err = n.Push(1)
+			}
+			assert.Equal(t, tt.ok, err == nil, "%v", err)
+			assert.Equal(t, tt.hits, atomic.LoadInt32(hits))
+		})
+	}
+}
+
+func TestRetryContextDone(t *testing.T) {
+	server, hits := statusServer(t, nil, 503, 503)
+	n := New(server.URL, nil)
+	n.RetryConfig = RetryConfig{Max: 3, BaseDelay: time.Hour}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	var v interface{}
+	err := n.GetWithContext(ctx, &v)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "%v", err)
+	assert.EqualValues(t, 1, atomic.LoadInt32(hits))
+}
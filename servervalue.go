@@ -0,0 +1,57 @@
+package nestapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// ServerTimestamp returns a placeholder that the server replaces with
+// its current time, in milliseconds since the Unix epoch, when written
+// with Set, Update or Push. It is only resolved server side; the value
+// itself is not a time.
+func ServerTimestamp() interface{} {
+	return map[string]interface{}{".sv": "timestamp"}
+}
+
+// ServerIncrement returns a placeholder that the server replaces with
+// the current value plus delta when written with Set, Update or Push.
+// A missing or non-numeric current value counts as zero. It is only
+// resolved server side.
+func ServerIncrement(delta float64) interface{} {
+	return map[string]interface{}{
+		".sv": map[string]interface{}{"increment": delta},
+	}
+}
+
+// Increment atomically adds delta to the numeric value of the NestAPI
+// reference, counting a missing or non-numeric value as zero. It uses a
+// server increment, and falls back to a Transaction when the server
+// rejects those as a bad request.
+func (n *NestAPI) Increment(delta float64) error {
+	var err error
+	if key := n.Key(); key == "" {
+		err = n.Set(ServerIncrement(delta))
+	} else {
+		err = n.Parent().Update(map[string]interface{}{key: ServerIncrement(delta)})
+	}
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		return err
+	}
+
+	return n.Transaction(func(current interface{}) (interface{}, error) {
+		switch v := current.(type) {
+		case float64:
+			return v + delta, nil
+		case json.Number:
+			f, err := v.Float64()
+			if err != nil {
+				return delta, nil
+			}
+			return f + delta, nil
+		}
+		return delta, nil
+	})
+}
@@ -0,0 +1,34 @@
+package nestapi
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIncrementConcurrent(t *testing.T) {
+	for name, noServerValues := range map[string]bool{
+		"server value": false,
+		"transaction":  true,
+	} {
+		t.Run(name, func(t *testing.T) {
+			server := newTestServer(t)
+			server.NoServerValues = noServerValues
+			n := New(server.URL, nil).Child("counter")
+
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					assert.NoError(t, n.Increment(1))
+				}()
+			}
+			wg.Wait()
+
+			assert.Equal(t, json.Number("10"), server.Get("/counter"))
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package nestapi
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+)
+
+// frame is a single server-sent event, as read from the stream.
+type frame struct {
+	event string
+	data  string
+	id    string
+	hasID bool
+	retry int
+}
+
+// readFrame reads the next frame, up to the blank line that ends it.
+//
+//	event: put
+//	data: {"path":"/","data":{"foo":"bar"}}
+//
+// Comments and unknown fields are ignored.
+func readFrame(r *bufio.Reader) (frame, error) {
+	var f frame
+	seen, hasData := false, false
+
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			return f, err
+		}
+
+		if len(line) == 0 {
+			if seen {
+				return f, nil
+			}
+			continue
+		}
+		seen = true
+
+		if line[0] == ':' {
+			continue
+		}
+
+		field, value := line, []byte(nil)
+		if i := bytes.IndexByte(line, ':'); i >= 0 {
+			field, value = line[:i], bytes.TrimPrefix(line[i+1:], []byte(" "))
+		}
+
+		switch string(field) {
+		case "event":
+			f.event = string(value)
+		case "data":
+			if hasData {
+				f.data += "\n"
+			}
+			f.data += string(value)
+			hasData = true
+		case "id":
+			f.id = string(value)
+			f.hasID = true
+		case "retry":
+			if v, err := strconv.Atoi(string(value)); err == nil {
+				f.retry = v
+			}
+		}
+	}
+}
+
+// readLine reads a whole line without its line ending. For possible
+// lines larger than the buffer of r, e.g. a large 'data:' value,
+// ReadLine returns the line in parts which are joined here.
+func readLine(r *bufio.Reader) ([]byte, error) {
+	var line []byte
+	for {
+		part, isPrefix, err := r.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, part...)
+		if !isPrefix {
+			return line, nil
+		}
+	}
+}
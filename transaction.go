@@ -0,0 +1,54 @@
+package nestapi
+
+import "errors"
+
+// maxTransactionAttempts bounds the number of read-modify-write cycles
+// a Transaction makes before giving up.
+const maxTransactionAttempts = 25
+
+// ErrTransactionAborted can be returned by a Transaction's function to
+// cancel the transaction without writing. Transaction then returns it.
+var ErrTransactionAborted = errors.New("nestapi: transaction aborted")
+
+// Transaction atomically modifies the value of the NestAPI reference.
+//
+// The current value is read and passed to fn, and the value fn returns
+// is written only if the stored value has not changed in between. On
+// conflict the cycle is retried with the new value, a bounded number of
+// times after which ErrETagMismatch is returned. If fn returns an
+// error, e.g. ErrTransactionAborted, nothing is written and the error
+// is returned.
+func (n *NestAPI) Transaction(fn func(current interface{}) (interface{}, error)) error {
+	for attempt := 0; attempt < maxTransactionAttempts; attempt++ {
+		var current interface{}
+		etag, err := n.GetWithETag(&current)
+		if err != nil {
+			return err
+		}
+
+		v, err := fn(current)
+		if err != nil {
+			return err
+		}
+
+		err = n.SetIfMatch(etag, v)
+		if err != ErrETagMismatch {
+			return err
+		}
+	}
+	return ErrETagMismatch
+}
+
+// Modify reads the value of the NestAPI reference, passes it to fn and
+// sets the value fn returns.
+//
+// It is not atomic: a change made by someone else between the read and
+// the write is silently overwritten. Use Transaction when the value may
+// be modified concurrently.
+func (n *NestAPI) Modify(fn func(cur interface{}) interface{}) error {
+	var cur interface{}
+	if err := n.Get(&cur); err != nil {
+		return err
+	}
+	return n.Set(fn(cur))
+}
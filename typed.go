@@ -0,0 +1,61 @@
+package nestapi
+
+// TypedEvent is an Event whose data is decoded into a T.
+type TypedEvent[T any] struct {
+	// Type of event that was received
+	Type string
+	// Path to the data that changed
+	Path string
+	// Data that changed, decoded for put and patch events and the zero
+	// value otherwise. For patch events only the changed children are set.
+	Data T
+	// Err is the error of an EventTypeError or EventTypeBadFrame event,
+	// or the error that occurred decoding Data, in which case Type is
+	// EventTypeError too.
+	Err error
+}
+
+// WatchTyped is like n.Watch but decodes the data of every event into
+// a T before passing it over to the given chan.
+func WatchTyped[T any](n *NestAPI, out chan TypedEvent[T]) error {
+	events := make(chan Event)
+	if err := n.Watch(events); err != nil {
+		return err
+	}
+
+	go func() {
+		for event := range events {
+			typed := TypedEvent[T]{
+				Type: event.Type,
+				Path: event.Path,
+			}
+
+			switch event.Type {
+			case EventTypePut, EventTypePatch:
+				if err := event.Value(&typed.Data); err != nil {
+					typed.Type = EventTypeError
+					typed.Err = err
+				}
+			case EventTypeError, EventTypeBadFrame:
+				typed.Err, _ = event.Data.(error)
+			}
+
+			out <- typed
+		}
+
+		close(out)
+	}()
+
+	return nil
+}
+
+// Get retrieves the value of the NestAPI reference as a T. A missing
+// value is returned as the zero value of T, without an error.
+func Get[T any](n *NestAPI) (T, error) {
+	var v T
+	if err := n.Get(&v); err != nil {
+		var zero T
+		return zero, err
+	}
+	return v, nil
+}
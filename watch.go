@@ -2,10 +2,18 @@ package nestapi
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"reflect"
 	"strings"
+	"sync"
+	"time"
 )
 
 const (
@@ -18,60 +26,330 @@ const (
 	// EventTypeError is the event type sent when an unknown error is encountered.
 	EventTypeError = "event_error"
 	// EventTypeAuthRevoked is the event type sent when the supplied auth parameter
-	// is no longer valid.
+	// is no longer valid. Its Data is the reason, as a string.
 	EventTypeAuthRevoked = "auth_revoked"
+	// EventTypeReconnecting is the event type sent by WatchWithReconnect when
+	// the connection was lost and is being re-established, and once a watch
+	// created with WithReauthOnRevoke was re-established with a new token.
+	// Changes made while disconnected may have been missed.
+	EventTypeReconnecting = "reconnecting"
+	// EventTypeRulesDebug is the event type sent with the security rules
+	// debug output when the NestAPI reference has RulesDebugEvents set.
+	EventTypeRulesDebug = "rules_debug"
+	// EventTypeBadFrame is the event type sent in place of a put or patch
+	// event that could not be parsed, when the NestAPI reference was
+	// created with WithSkipBadFrames. Its Data is the error and its
+	// RawData the data of the frame. The watch carries on after it.
+	EventTypeBadFrame = "bad_frame"
 
-	eventTypeKeepAlive  = "keep-alive"
-	eventTypeCancel     = "cancel"
-	eventTypeRulesDebug = "rules_debug"
+	eventTypeKeepAlive = "keep-alive"
+	eventTypeCancel    = "cancel"
+
+	reconnectBaseDelay = time.Second
+	reconnectMaxDelay  = 30 * time.Second
 )
 
+// ErrAlreadyWatching is returned by WatchFunc when the NestAPI reference
+// is already being watched.
+var ErrAlreadyWatching = errors.New("nestapi: already watching")
+
 // Event represents a notification received when watching a
 // firebase reference.
 type Event struct {
-	// Type of event that was received
+	// Type of event that was received, as the server named it
 	Type string
+	// NormalizedType is Type with the variants of event names used by
+	// some servers mapped to the standard name, e.g. "revoke" to
+	// EventTypeAuthRevoked
+	NormalizedType string
 	// Path to the data that changed
 	Path string
 	// Data that changed
 	Data interface{}
 
 	RawData string
+
+	// ID is the id the server sent with the event, if any
+	ID string
+	// Retry is the reconnection delay in milliseconds the server
+	// sent with the event, if any
+	Retry int
+
+	// ReceivedAt is when the event was read from the connection, or
+	// created for the events that don't come from the server
+	ReceivedAt time.Time
+
+	useNumber bool
 }
 
 // Value converts the raw payload of the event into the given interface.
+// Numbers are decoded as json.Number if the watched reference was
+// created with WithUseNumber.
 func (e Event) Value(v interface{}) error {
 	var tmp struct {
 		Data interface{} `json:"data"`
 	}
 	tmp.Data = &v
 
+	if e.useNumber {
+		return decodeUseNumber([]byte(e.RawData), &tmp)
+	}
 	return json.Unmarshal([]byte(e.RawData), &tmp)
 }
 
+// IsTerminal reports whether the event ends the watch, i.e. it is an
+// error, a cancel or an auth_revoked event. With WithReauthOnRevoke, an
+// auth_revoked event is only passed over if the watch then ends.
+func (e Event) IsTerminal() bool {
+	switch e.kind() {
+	case EventTypeError, EventTypeAuthRevoked, eventTypeCancel:
+		return true
+	}
+	return false
+}
+
+// kind returns the normalized type of the event, falling back to its
+// type for events that were not received from the server.
+func (e Event) kind() string {
+	if e.NormalizedType != "" {
+		return e.NormalizedType
+	}
+	return e.Type
+}
+
+// normalizeEventType maps the variants of the event names used by some
+// servers to the standard name.
+func normalizeEventType(t string) string {
+	if t != EventTypeAuthRevoked && strings.Contains(strings.ToLower(t), "revoke") {
+		return EventTypeAuthRevoked
+	}
+	return t
+}
+
+// unquote returns the string encoded as JSON in s, or s itself if it
+// is not a JSON string.
+func unquote(s string) string {
+	var v string
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return s
+	}
+	return v
+}
+
+// Merge applies the data of a put or patch event onto into, which must
+// be a pointer to the last known value at the watched reference. The
+// event's Path is relative to that reference; a patch only replaces
+// the children it names, while a put replaces the whole subtree at Path.
+func (e Event) Merge(into interface{}) error {
+	if e.Type != EventTypePut && e.Type != EventTypePatch {
+		return fmt.Errorf("nestapi: cannot merge %s event", e.Type)
+	}
+
+	rv := reflect.ValueOf(into)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("nestapi: cannot merge into non-pointer %T", into)
+	}
+
+	b, err := json.Marshal(into)
+	if err != nil {
+		return err
+	}
+	var current interface{}
+	if err := decodeUseNumber(b, &current); err != nil {
+		return err
+	}
+
+	var payload struct {
+		Data interface{} `json:"data"`
+	}
+	if err := decodeUseNumber([]byte(e.RawData), &payload); err != nil {
+		return err
+	}
+
+	path := splitPath(e.Path)
+	if e.Type == EventTypePut {
+		current = mergePath(current, path, payload.Data)
+	} else if children, ok := payload.Data.(map[string]interface{}); ok {
+		for k, v := range children {
+			current = mergePath(current, append(path[:len(path):len(path)], splitPath(k)...), v)
+		}
+	}
+
+	if b, err = json.Marshal(current); err != nil {
+		return err
+	}
+	// reset the target so that removed fields don't linger
+	rv.Elem().Set(reflect.Zero(rv.Elem().Type()))
+	return json.Unmarshal(b, into)
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+// mergePath returns node with the value at path replaced by data,
+// creating intermediate objects as needed. A nil data removes the key.
+func mergePath(node interface{}, path []string, data interface{}) interface{} {
+	if len(path) == 0 {
+		return data
+	}
+
+	m, ok := node.(map[string]interface{})
+	if !ok {
+		m = map[string]interface{}{}
+	}
+
+	child := mergePath(m[path[0]], path[1:], data)
+	if child == nil {
+		delete(m, path[0])
+	} else {
+		m[path[0]] = child
+	}
+	return m
+}
+
+// valueAt returns the value at path below node, or nil if there is none.
+func valueAt(node interface{}, path []string) interface{} {
+	for _, key := range path {
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		node = m[key]
+	}
+	return node
+}
+
+func decodeUseNumber(b []byte, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	return d.Decode(v)
+}
+
 // StopWatching stops tears down all connections that are watching.
+//
+// It is safe to call at any time, from any goroutine, and any number
+// of times.
 func (n *NestAPI) StopWatching() {
-	if n.isWatching() {
-		// signal connection to terminal
-		n.stopWatching <- struct{}{}
-		// flip the bit back to not watching
-		n.setWatching(false)
+	n.watchMtx.Lock()
+	defer n.watchMtx.Unlock()
+
+	if n.watching {
+		// flip the bit back to not watching and
+		// signal connection to terminate
+		n.watching = false
+		close(n.stopWatching)
 	}
 }
 
-func (n *NestAPI) isWatching() bool {
+// DrainAndStop stops watching gracefully: the connection is closed so
+// that no new events are received, but the events already received,
+// including those queued by WithEventBuffer, are still passed over
+// before the chan is closed. If that takes longer than timeout, e.g.
+// because the consumer is slow, the watch is stopped as by StopWatching,
+// dropping the remaining events, and an error is returned.
+//
+// It returns once the last event is sent on the chan, so with a
+// buffered chan the consumer may not have received all of them yet;
+// they remain in the chan after it is closed.
+func (n *NestAPI) DrainAndStop(timeout time.Duration) error {
 	n.watchMtx.Lock()
-	v := n.watching
+	if !n.watching {
+		n.watchMtx.Unlock()
+		return nil
+	}
+	stopWatching, done := n.stopWatching, n.watchDone
+	if !isClosed(n.drainWatch) {
+		close(n.drainWatch)
+	}
 	n.watchMtx.Unlock()
-	return v
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+
+	select {
+	case <-done:
+		n.endWatch(stopWatching)
+		return nil
+	case <-t.C:
+		n.endWatch(stopWatching)
+		return fmt.Errorf("nestapi: events not drained within %s", timeout)
+	}
 }
 
-func (n *NestAPI) setWatching(v bool) {
+// LastEventID returns the id of the last event received by the current
+// or last watch that carried one. When the connection of a watch is
+// re-established, it is sent in the Last-Event-ID header so that a
+// server that supports it can replay the events missed in between.
+func (n *NestAPI) LastEventID() string {
 	n.watchMtx.Lock()
-	n.watching = v
+	defer n.watchMtx.Unlock()
+	return n.lastEventID
+}
+
+func (n *NestAPI) setLastEventID(id string) {
+	n.watchMtx.Lock()
+	n.lastEventID = id
 	n.watchMtx.Unlock()
 }
 
+// LastWatchError returns why the last watch of the NestAPI reference
+// ended, once its chan is closed: nil if it was stopped with
+// StopWatching, the context's error if its context is done, or the
+// error that ended the connection otherwise. It is nil while watching.
+func (n *NestAPI) LastWatchError() error {
+	n.watchMtx.Lock()
+	defer n.watchMtx.Unlock()
+	return n.watchErr
+}
+
+// beginWatch flips the bit to watching and returns the channel that is
+// closed when the watch is stopped, the one that is closed when it is
+// drained and the one to close once it is done, or false if already
+// watching.
+func (n *NestAPI) beginWatch() (chan struct{}, chan struct{}, chan struct{}, bool) {
+	n.watchMtx.Lock()
+	defer n.watchMtx.Unlock()
+
+	if n.watching {
+		return nil, nil, nil, false
+	}
+	n.watching = true
+	n.watchErr = nil
+	n.lastEventID = ""
+	n.stopWatching = make(chan struct{})
+	n.drainWatch = make(chan struct{})
+	n.watchDone = make(chan struct{})
+	return n.stopWatching, n.drainWatch, n.watchDone, true
+}
+
+// recordWatchErr sets the error LastWatchError returns, unless a new
+// watch has begun since the one of stopWatching.
+func (n *NestAPI) recordWatchErr(stopWatching chan struct{}, err error) {
+	n.watchMtx.Lock()
+	defer n.watchMtx.Unlock()
+
+	if n.stopWatching == stopWatching {
+		n.watchErr = err
+	}
+}
+
+// endWatch stops the watch that stopWatching belongs to,
+// if it is still the current one.
+func (n *NestAPI) endWatch(stopWatching chan struct{}) {
+	n.watchMtx.Lock()
+	defer n.watchMtx.Unlock()
+
+	if n.watching && n.stopWatching == stopWatching {
+		n.watching = false
+		close(stopWatching)
+	}
+}
+
 // Watch listens for changes on a firebase instance and
 // passes over to the given chan.
 //
@@ -79,138 +357,750 @@ func (n *NestAPI) setWatching(v bool) {
 // second call to this function without a call to n.StopWatching
 // will close the channel given and return nil immediately.
 func (n *NestAPI) Watch(notifications chan Event) error {
-	if n.isWatching() {
+	return n.WatchWithContext(context.Background(), notifications)
+}
+
+// WatchWithContext is like Watch but the connection is also torn
+// down, and the given chan closed, once ctx is done. Either ctx or
+// n.StopWatching may be used to stop the watch.
+func (n *NestAPI) WatchWithContext(ctx context.Context, notifications chan Event) error {
+	return closeIfWatching(n.startWatch(ctx, notifications, false), notifications)
+}
+
+// WatchWithReconnect is like Watch but when the connection is lost for
+// any reason other than n.StopWatching, a cancel or an auth_revoked
+// event, it is re-established with exponential backoff on the same chan.
+//
+// An EventTypeReconnecting event is sent before every reconnection
+// attempt in place of the EventTypeError event that Watch would send.
+// If a reconnection attempt is rejected with a client error other than
+// 429 Too Many Requests, e.g. a 401 Unauthorized, it is not retried and
+// the watch ends with an EventTypeError event carrying the APIError.
+func (n *NestAPI) WatchWithReconnect(notifications chan Event) error {
+	return closeIfWatching(n.startWatch(context.Background(), notifications, true), notifications)
+}
+
+// closeIfWatching closes notifications and returns nil if err is
+// ErrAlreadyWatching, as Watch documents, and returns err otherwise.
+func closeIfWatching(err error, notifications chan Event) error {
+	if err == ErrAlreadyWatching {
 		close(notifications)
 		return nil
 	}
+	return err
+}
+
+// WatchFunc is like Watch but calls handler synchronously for every
+// event instead of sending it on a chan. The returned func stops
+// watching; once it returns handler is not called again. It must not
+// be called from within handler. If n is already being watched,
+// ErrAlreadyWatching is returned and the existing watch is left alone.
+func (n *NestAPI) WatchFunc(handler func(Event)) (func(), error) {
+	notifications := make(chan Event)
+	if err := n.startWatch(context.Background(), notifications, false); err != nil {
+		return nil, err
+	}
+
+	var mtx sync.Mutex
+	stopped := false
+
+	go func() {
+		for event := range notifications {
+			mtx.Lock()
+			if !stopped {
+				handler(event)
+			}
+			mtx.Unlock()
+		}
+	}()
+
+	return func() {
+		n.StopWatching()
+
+		mtx.Lock()
+		stopped = true
+		mtx.Unlock()
+	}, nil
+}
+
+// WatchChild watches the given child of the NestAPI reference on its
+// own connection and returns a func that stops it. Any number of
+// children may be watched at once; stopping one doesn't affect the
+// others or a watch on n itself.
+func (n *NestAPI) WatchChild(child string, notifications chan Event) (func(), error) {
+	c := n.Child(child)
+	if err := c.Watch(notifications); err != nil {
+		return nil, err
+	}
+	return c.StopWatching, nil
+}
+
+// WatchValue is like Watch but only passes over the put and patch
+// events that change the value at the NestAPI reference, suppressing
+// those that write the same data again, e.g. from idempotent writers
+// or the initial put after a reconnection.
+//
+// To do so it keeps a copy of the whole value at the reference for as
+// long as it watches, so it should not be used on large nodes.
+func (n *NestAPI) WatchValue(notifications chan Event) error {
+	events := make(chan Event)
+	if err := n.Watch(events); err != nil {
+		return err
+	}
+
+	go func() {
+		// the first event is always passed over, even if its data is
+		// null and so matches the initial state
+		var state interface{}
+		initialized := false
+		for event := range events {
+			if event.Type == EventTypePut || event.Type == EventTypePatch {
+				var changed bool
+				if state, changed = applyEvent(state, event); !changed && initialized {
+					continue
+				}
+				initialized = true
+			}
+			notifications <- event
+		}
+
+		close(notifications)
+	}()
+
+	return nil
+}
+
+// applyEvent applies the data of a put or patch event onto state,
+// reporting whether any of the values it names changed. An event
+// whose data can't be decoded is reported as a change.
+func applyEvent(state interface{}, e Event) (interface{}, bool) {
+	var payload struct {
+		Data interface{} `json:"data"`
+	}
+	if err := decodeUseNumber([]byte(e.RawData), &payload); err != nil {
+		return state, true
+	}
+
+	writes := map[string]interface{}{"": payload.Data}
+	if e.Type == EventTypePatch {
+		children, ok := payload.Data.(map[string]interface{})
+		if !ok {
+			return state, true
+		}
+		writes = children
+	}
+
+	changed := false
+	path := splitPath(e.Path)
+	for k, v := range writes {
+		p := append(path[:len(path):len(path)], splitPath(k)...)
+		if reflect.DeepEqual(valueAt(state, p), v) {
+			continue
+		}
+		changed = true
+		state = mergePath(state, p, v)
+	}
+	return state, changed
+}
+
+// coalesce returns the event that has the effect of prev followed by e,
+// two put or patch events for the same path: e itself if it is a put,
+// and otherwise prev with the children of e written on top of it.
+func coalesce(prev, e Event) Event {
+	children, ok := e.Data.(map[string]interface{})
+	if e.Type != EventTypePatch || !ok {
+		return e
+	}
+
+	data := prev.Data
+	switch prev.Type {
+	case EventTypePut:
+		for k, v := range children {
+			data = mergePath(data, splitPath(k), v)
+		}
+	case EventTypePatch:
+		merged, ok := data.(map[string]interface{})
+		if !ok {
+			return e
+		}
+		for k, v := range children {
+			mergeChild(merged, splitPath(k), v)
+		}
+	}
+
+	raw, err := json.Marshal(struct {
+		Path string      `json:"path"`
+		Data interface{} `json:"data"`
+	}{e.Path, data})
+	if err != nil {
+		return e
+	}
+
+	e.Type, e.NormalizedType = prev.Type, prev.NormalizedType
+	e.Data, e.RawData = data, string(raw)
+	return e
+}
+
+// mergeChild writes v at path into the children of a patch, replacing
+// the children below path and merging into a child above it.
+func mergeChild(children map[string]interface{}, path []string, v interface{}) {
+	for k := range children {
+		p := splitPath(k)
+		switch {
+		case hasPrefix(p, path):
+			delete(children, k)
+		case hasPrefix(path, p):
+			children[k] = mergePath(children[k], path[len(p):], v)
+			return
+		}
+	}
+	children[strings.Join(path, "/")] = v
+}
+
+// hasPrefix reports whether path starts with the keys of prefix.
+func hasPrefix(path, prefix []string) bool {
+	if len(path) < len(prefix) {
+		return false
+	}
+	for i, key := range prefix {
+		if path[i] != key {
+			return false
+		}
+	}
+	return true
+}
+
+// WatchDebounced is like Watch but coalesces the put and patch events
+// for a path that arrive within interval of the first of them, passing
+// over a single event once interval has elapsed. A put replaces the
+// pending event, while a patch is merged into it, so that the children
+// named by every patch are passed over with their most recent values.
+//
+// Each path is debounced on its own, so events for different paths
+// may be passed over in a different order than they arrived. Any other
+// event, such as a terminal one, is passed over immediately, after all
+// the pending events.
+func (n *NestAPI) WatchDebounced(interval time.Duration, notifications chan Event) error {
+	events := make(chan Event)
+	if err := n.Watch(events); err != nil {
+		return err
+	}
+
+	go func() {
+		defer close(notifications)
+
+		// paths with a pending event, in the order they are due
+		var order []string
+		pending := map[string]Event{}
+		due := map[string]time.Time{}
+
+		var timeout <-chan time.Time
+		flush := func(all bool) {
+			now := time.Now()
+			for len(order) > 0 && (all || !due[order[0]].After(now)) {
+				path := order[0]
+				order = order[1:]
+				notifications <- pending[path]
+				delete(pending, path)
+				delete(due, path)
+			}
+
+			timeout = nil
+			if len(order) > 0 {
+				timeout = time.After(time.Until(due[order[0]]))
+			}
+		}
+
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					flush(true)
+					return
+				}
+				if event.Type != EventTypePut && event.Type != EventTypePatch {
+					flush(true)
+					notifications <- event
+					continue
+				}
+
+				if _, ok := pending[event.Path]; !ok {
+					order = append(order, event.Path)
+					due[event.Path] = time.Now().Add(interval)
+					if len(order) == 1 {
+						timeout = time.After(interval)
+					}
+				}
+				if prev, ok := pending[event.Path]; ok {
+					event = coalesce(prev, event)
+				}
+				pending[event.Path] = event
+			case <-timeout:
+				flush(false)
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (n *NestAPI) startWatch(ctx context.Context, notifications chan Event, reconnect bool) error {
 	// set watching flag
-	n.setWatching(true)
+	stopWatching, drain, done, ok := n.beginWatch()
+	if !ok {
+		return ErrAlreadyWatching
+	}
 
+	// hangup closes the connection, stop also drops the queued events
+	hangup := make(chan struct{})
 	stop := make(chan struct{})
-	events, err := n.watch(stop)
+	events, err := n.openStream(ctx, hangup, stop)
 	if err != nil {
+		n.recordWatchErr(stopWatching, err)
+		n.endWatch(stopWatching)
 		return err
 	}
 
-	var closedManually bool
-
-	// monitor the stopWatching channel
+	// monitor the stopWatching channel and the context
 	// if we're told to stop, close the response Body
 	go func() {
-		<-n.stopWatching
+		select {
+		case <-drain:
+			close(hangup)
+			select {
+			case <-stopWatching:
+			case <-ctx.Done():
+				n.endWatch(stopWatching)
+			}
+		case <-stopWatching:
+			close(hangup)
+		case <-ctx.Done():
+			n.endWatch(stopWatching)
+			close(hangup)
+		}
 
-		closedManually = true
 		close(stop)
 	}()
 
 	go func() {
-		for event := range events {
-			if event.Type == EventTypeError && closedManually {
-				break
+		var watchErr error
+		defer func() {
+			// record why the watch ended and allow a new one to begin
+			// before the consumer sees the close
+			n.recordWatchErr(stopWatching, watchErr)
+			n.endWatch(stopWatching)
+			close(notifications)
+			close(done)
+		}()
+
+		attempt := 0
+		for {
+			var last Event
+			received, gotData := false, false
+			for event := range events {
+				if event.Type == EventTypeError && isClosed(hangup) {
+					watchErr = ctx.Err()
+					return
+				}
+
+				last = event
+				if reconnect && event.Type == EventTypeError {
+					continue
+				}
+				// a revoke is held back until it is known whether the
+				// watch is re-established
+				if event.kind() == EventTypeAuthRevoked && gotData && n.reauth() {
+					continue
+				}
+
+				received = true
+				gotData = gotData || event.Type == EventTypePut || event.Type == EventTypePatch
+				notifications <- event
 			}
 
-			notifications <- event
-		}
+			if isClosed(hangup) {
+				watchErr = ctx.Err()
+				return
+			}
 
-		close(notifications)
+			// a connection revoked before any data arrived isn't
+			// re-established again, lest it loops forever
+			if last.kind() == EventTypeAuthRevoked && gotData && n.reauth() {
+				var err error
+				if events, err = n.openStream(ctx, hangup, stop); err == nil {
+					reason := lastEventError(last)
+					notifications <- Event{
+						Type:           EventTypeReconnecting,
+						NormalizedType: EventTypeReconnecting,
+						Data:           reason,
+						RawData:        reason.Error(),
+						ReceivedAt:     time.Now(),
+					}
+					continue
+				}
+				if isClosed(hangup) {
+					watchErr = ctx.Err()
+					return
+				}
+				notifications <- last
+				watchErr = err
+				return
+			}
+			if !reconnect || last.kind() == eventTypeCancel || last.kind() == EventTypeAuthRevoked {
+				watchErr = lastEventError(last)
+				return
+			}
+
+			if received {
+				attempt = 0
+			}
+
+			var reason error
+			if last.kind() == EventTypeError {
+				reason, _ = last.Data.(error)
+			}
+
+			for {
+				event := Event{
+					Type:           EventTypeReconnecting,
+					NormalizedType: EventTypeReconnecting,
+					ReceivedAt:     time.Now(),
+				}
+				if reason != nil {
+					event.Data = reason
+					event.RawData = reason.Error()
+				}
+				notifications <- event
+
+				if !wait(reconnectDelay(attempt), hangup) {
+					watchErr = ctx.Err()
+					return
+				}
+				attempt++
+
+				if events, reason = n.openStream(ctx, hangup, stop); reason == nil {
+					break
+				}
+
+				// e.g. the credentials were rejected, which
+				// reconnecting again won't change
+				if isPermanent(reason) {
+					notifications <- Event{
+						Type:           EventTypeError,
+						NormalizedType: EventTypeError,
+						Data:           reason,
+						RawData:        reason.Error(),
+						ReceivedAt:     time.Now(),
+					}
+					watchErr = reason
+					return
+				}
+			}
+		}
 	}()
 
 	return nil
 }
 
-func (n *NestAPI) watch(stop chan struct{}) (chan Event, error) {
-	// build SSE request
-	req, err := http.NewRequest("GET", n.String(), nil)
-	if err != nil {
-		n.setWatching(false)
-		return nil, err
+// reauth reports whether a watch should be re-established after its auth
+// was revoked, which requires WithReauthOnRevoke and an auth provider.
+// The provider is called for the new connection, which fails with its
+// error if it can't return a token.
+func (n *NestAPI) reauth() bool {
+	return n.opts.reauthOnRevoke && n.authFunc != nil
+}
+
+// lastEventError returns the error that the last event of a
+// connection ended it with.
+func lastEventError(last Event) error {
+	switch last.kind() {
+	case EventTypeError:
+		if err, ok := last.Data.(error); ok {
+			return err
+		}
+	case eventTypeCancel:
+		return fmt.Errorf("nestapi: watch cancelled by the server: %s", last.Data)
+	case EventTypeAuthRevoked:
+		return fmt.Errorf("nestapi: auth revoked: %s", last.Data)
 	}
-	req.Header.Add("Accept", "text/event-stream")
+	return fmt.Errorf("nestapi: watch connection closed")
+}
 
-	// do request
-	resp, err := n.client.Do(req)
-	if err != nil {
-		n.setWatching(false)
+// openStream opens the event stream, buffered if the reference was
+// created with WithEventBuffer. The connection is closed once hangup
+// is, and the queued events are dropped once stop is.
+func (n *NestAPI) openStream(ctx context.Context, hangup, stop chan struct{}) (chan Event, error) {
+	events, err := n.watch(ctx, hangup)
+	if err != nil || n.opts.eventBuffer <= 0 {
+		return events, err
+	}
+	return bufferEvents(events, n.opts.eventBuffer, stop), nil
+}
+
+// bufferEvents queues up to size events from in so that a slow consumer
+// doesn't hold up reading the stream. When the queue is full the oldest
+// event is dropped.
+func bufferEvents(in chan Event, size int, stop chan struct{}) chan Event {
+	out := make(chan Event)
+
+	go func() {
+		defer close(out)
+
+		var queue []Event
+		for in != nil || len(queue) > 0 {
+			var send chan Event
+			var next Event
+			if len(queue) > 0 {
+				send, next = out, queue[0]
+			}
+
+			select {
+			case event, ok := <-in:
+				if !ok {
+					in = nil
+					continue
+				}
+				if len(queue) == size {
+					queue = queue[1:]
+				}
+				queue = append(queue, event)
+			case send <- next:
+				queue = queue[1:]
+			case <-stop:
+				// let the parser finish
+				if in != nil {
+					for range in {
+					}
+				}
+				return
+			}
+		}
+	}()
+	return out
+}
+
+func reconnectDelay(attempt int) time.Duration {
+	d := RetryConfig{BaseDelay: reconnectBaseDelay}.delay(attempt, nil)
+	if d > reconnectMaxDelay {
+		d = reconnectMaxDelay
+	}
+	return d
+}
+
+// wait blocks for d or until stop is closed, reporting
+// whether the full duration elapsed.
+func wait(d time.Duration, stop chan struct{}) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-stop:
+		return false
+	}
+}
+
+func isClosed(c chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+// streamClient returns the client to watch with, which is the client
+// of the reference without the timeout set by WithRequestTimeout.
+func (n *NestAPI) streamClient() *http.Client {
+	if !n.ownsClient || n.client.Timeout == 0 {
+		return n.client
+	}
+	c := *n.client
+	c.Timeout = 0
+	return &c
+}
+
+func (n *NestAPI) watch(ctx context.Context, stop chan struct{}) (chan Event, error) {
+	if n.err != nil {
+		return nil, n.err
+	}
+	if err := n.Validate(); err != nil {
 		return nil, err
 	}
+	url := n.String()
+	var resp *http.Response
+	for redirects := 0; ; redirects++ {
+		// build SSE request
+		req, err := n.newRequest(ctx, "GET", url, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Add("Accept", "text/event-stream")
+
+		// let a server that supports it replay the events
+		// missed since the connection was lost
+		if id := n.LastEventID(); id != "" {
+			req.Header.Set("Last-Event-ID", id)
+		}
+
+		// do request
+		resp, err = n.streamClient().Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		// check for 307 redirect to the streaming endpoint
+		if resp.StatusCode != http.StatusTemporaryRedirect {
+			break
+		}
+
+		loc, err := resp.Location()
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if redirects >= n.opts.maxRedirects {
+			return nil, fmt.Errorf("%d consecutive requests(redirects)", redirects+1)
+		}
+		url = loc.String()
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		r, err := decodeBody(resp)
+		if err != nil {
+			return nil, err
+		}
+		body, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, timeoutError(err)
+		}
+		return nil, newAPIError(resp.StatusCode, body)
+	}
 
 	notifications := make(chan Event)
 
+	done := make(chan struct{})
+	reading := make(chan bool)
+	idle := make(chan struct{})
+
+	// close the response Body when stopped, or when no event, not even a
+	// keep-alive, arrived in time as the connection is then likely dead.
+	// Only the time spent waiting for the server counts, not the time
+	// the consumer takes to receive the events.
 	go func() {
-		<-stop
 		defer resp.Body.Close()
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if n.opts.watchTimeout > 0 {
+			timer = time.NewTimer(n.opts.watchTimeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+
+		for {
+			select {
+			case r := <-reading:
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				if r {
+					timer.Reset(n.opts.watchTimeout)
+				}
+			case <-timeout:
+				close(idle)
+				return
+			case <-stop:
+				return
+			case <-done:
+				return
+			}
+		}
 	}()
 
 	// start parsing response body
 	go func() {
+		defer close(done)
+
+		// build reader for response body
+		body, scanErr := decodeBody(resp)
+		if scanErr != nil {
+			body = resp.Body
+		}
+		if n.RawStreamWriter != nil {
+			body = io.TeeReader(body, n.RawStreamWriter)
+		}
+		reader := bufio.NewReader(body)
 
-		// build scanner for response body
-		scanner := bufio.NewReader(resp.Body)
-		var scanErr error
+		// watchdog runs the timer of the monitor while reading a frame
+		watchdog := func(r bool) {
+			if n.opts.watchTimeout <= 0 {
+				return
+			}
+			select {
+			case reading <- r:
+			case <-idle:
+			case <-stop:
+			}
+		}
 
 	scanning:
 		for scanErr == nil {
-			// split event string
-			// 		event: put
-			// 		data: {"path":"/","data":{"foo":"bar"}}
-
-			var evt []byte
-			var dat []byte
-			isPrefix := true
-			var result []byte
-
-			// For possible results larger than 64 * 1024 bytes (MaxTokenSize)
-			// we need bufio#ReadLine()
-			// 1. step: scan for the 'event:' part. ReadLine() oes not return the \n
-			// so we have to add it to our result buffer.
-			evt, isPrefix, scanErr = scanner.ReadLine()
+			watchdog(true)
+			var f frame
+			f, scanErr = readFrame(reader)
 			if scanErr != nil {
 				break scanning
 			}
-			result = append(result, evt...)
-			result = append(result, '\n')
-
-			// 2. step: scan for the 'data:' part. NestAPI returns just one 'data:'
-			// part, but the value can be very large. If we exceed a certain length
-			// isPrefix will be true until all data is read.
-			for {
-				dat, isPrefix, scanErr = scanner.ReadLine()
-				if scanErr != nil {
-					break scanning
-				}
-				result = append(result, dat...)
-				if !isPrefix {
-					break
-				}
+			watchdog(false)
+			if f.hasID {
+				n.setLastEventID(f.id)
 			}
-			// Again we add the \n
-			result = append(result, '\n')
-			_, _, scanErr = scanner.ReadLine()
-			if scanErr != nil {
-				break scanning
-			}
-
-			txt := string(result)
-			parts := strings.Split(txt, "\n")
 
 			// create a base event
 			event := Event{
-				Type:    strings.Replace(parts[0], "event: ", "", 1),
-				RawData: strings.Replace(parts[1], "data: ", "", 1),
+				Type:           f.event,
+				NormalizedType: normalizeEventType(f.event),
+				RawData:        f.data,
+				ID:             f.id,
+				Retry:          f.retry,
+				ReceivedAt:     time.Now(),
+				useNumber:      n.opts.useNumber,
 			}
 
 			// should be reacting differently based off the type of event
-			switch event.Type {
+			switch event.NormalizedType {
 			case EventTypePut, EventTypePatch:
 				// we've got extra data we've got to parse
 				var data map[string]interface{}
-				if err := json.Unmarshal([]byte(strings.Replace(parts[1], "data: ", "", 1)), &data); err != nil {
-					scanErr = err
-					break scanning
+				err := n.unmarshal([]byte(event.RawData), &data)
+				path, ok := data["path"].(string)
+				if err == nil && !ok {
+					err = fmt.Errorf("nestapi: malformed %s event, missing path: %s", event.Type, event.RawData)
+				}
+				if err != nil {
+					if !n.opts.skipBadFrames {
+						scanErr = err
+						break scanning
+					}
+					notifications <- Event{
+						Type:           EventTypeBadFrame,
+						NormalizedType: EventTypeBadFrame,
+						Data:           err,
+						RawData:        event.RawData,
+						ID:             event.ID,
+						ReceivedAt:     event.ReceivedAt,
+					}
+					continue
 				}
 
 				// set the extra fields
-				event.Path = data["path"].(string)
+				event.Path = path
 				event.Data = data["data"]
 
 				// ship it
@@ -228,19 +1118,30 @@ func (n *NestAPI) watch(stop chan struct{}) (chan Event, error) {
 			case EventTypeAuthRevoked:
 				// The data for this event is a string indicating that a the credential has expired
 				// This event will be sent when the supplied auth parameter is no longer valid
-				event.Data = strings.Replace(parts[1], "data: ", "", 1)
+				event.Data = unquote(event.RawData)
 				notifications <- event
 				break scanning
-			case eventTypeRulesDebug:
-				log.Printf("Rules-Debug: %s\n", txt)
+			case EventTypeRulesDebug:
+				if n.RulesDebugEvents {
+					event.Data = event.RawData
+					notifications <- event
+				} else {
+					n.logf("Rules-Debug: %s\n", event.RawData)
+				}
 			}
 		}
 
+		if isClosed(idle) {
+			scanErr = fmt.Errorf("nestapi: no events received for %s", n.opts.watchTimeout)
+		}
+
 		if scanErr != nil {
 			notifications <- Event{
-				Type:    EventTypeError,
-				Data:    scanErr,
-				RawData: scanErr.Error(),
+				Type:           EventTypeError,
+				NormalizedType: EventTypeError,
+				Data:           scanErr,
+				RawData:        scanErr.Error(),
+				ReceivedAt:     time.Now(),
 			}
 		}
 
@@ -0,0 +1,658 @@
+package nestapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// streamServer returns a server whose handler is called with the number
+// of the connection, starting at 1, for every watch connection.
+func streamServer(t *testing.T, handler func(w http.ResponseWriter, r *http.Request, conn int)) *httptest.Server {
+	var conns int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler(w, r, int(atomic.AddInt32(&conns, 1)))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// sendEvent writes an SSE frame and flushes it to the client.
+func sendEvent(w http.ResponseWriter, event, data string) {
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	w.(http.Flusher).Flush()
+}
+
+// collect receives the events from notifications until it is closed.
+func collect(t *testing.T, notifications chan Event) []Event {
+	var events []Event
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event, ok := <-notifications:
+			if !ok {
+				return events
+			}
+			events = append(events, event)
+		case <-timeout:
+			t.Fatal("timed out waiting for the notifications to close")
+		}
+	}
+}
+
+func TestWatchUnauthorized(t *testing.T) {
+	server := streamServer(t, func(w http.ResponseWriter, r *http.Request, conn int) {
+		writeError(w, http.StatusUnauthorized, "Permission denied")
+	})
+
+	err := New(server.URL, nil).Watch(make(chan Event))
+	require.Error(t, err)
+	assert.True(t, IsUnauthorized(err))
+}
+
+func TestWatchWithReconnectUnauthorized(t *testing.T) {
+	server := streamServer(t, func(w http.ResponseWriter, r *http.Request, conn int) {
+		if conn > 1 {
+			writeError(w, http.StatusUnauthorized, "Permission denied")
+			return
+		}
+		sendEvent(w, EventTypePut, `{"path":"/","data":1}`)
+	})
+
+	notifications := make(chan Event)
+	require.NoError(t, New(server.URL, nil).WatchWithReconnect(notifications))
+
+	events := collect(t, notifications)
+	require.Len(t, events, 3)
+	assert.Equal(t, EventTypePut, events[0].Type)
+	assert.Equal(t, EventTypeReconnecting, events[1].Type)
+	assert.Equal(t, EventTypeError, events[2].Type)
+	assert.True(t, IsUnauthorized(events[2].Data.(error)))
+}
+
+func TestWatchMissingPath(t *testing.T) {
+	server := streamServer(t, func(w http.ResponseWriter, r *http.Request, conn int) {
+		sendEvent(w, EventTypePut, `{"data":{"foo":"bar"}}`)
+	})
+
+	notifications := make(chan Event)
+	require.NoError(t, New(server.URL, nil).Watch(notifications))
+
+	events := collect(t, notifications)
+	require.Len(t, events, 1)
+	assert.Equal(t, EventTypeError, events[0].Type)
+	assert.Contains(t, events[0].RawData, "missing path")
+}
+
+func TestEventMerge(t *testing.T) {
+	v := map[string]interface{}{
+		"a": map[string]interface{}{
+			"b": map[string]interface{}{"c": 1, "d": 2},
+			"e": 3,
+		},
+	}
+
+	patch := Event{Type: EventTypePatch, Path: "/a/b", RawData: `{"path":"/a/b","data":{"c":5,"d":null}}`}
+	require.NoError(t, patch.Merge(&v))
+	assert.Equal(t, map[string]interface{}{
+		"a": map[string]interface{}{
+			"b": map[string]interface{}{"c": float64(5)},
+			"e": float64(3),
+		},
+	}, v)
+
+	put := Event{Type: EventTypePut, Path: "/a/b", RawData: `{"path":"/a/b","data":{"x":true}}`}
+	require.NoError(t, put.Merge(&v))
+	assert.Equal(t, map[string]interface{}{"x": true}, v["a"].(map[string]interface{})["b"])
+
+	cancel := Event{Type: eventTypeCancel}
+	assert.Error(t, cancel.Merge(&v))
+}
+
+func TestStopWatchingConcurrent(t *testing.T) {
+	server := streamServer(t, func(w http.ResponseWriter, r *http.Request, conn int) {
+		sendEvent(w, EventTypePut, `{"path":"/","data":1}`)
+		<-r.Context().Done()
+	})
+
+	n := New(server.URL, nil)
+	n.StopWatching()
+
+	notifications := make(chan Event)
+	require.NoError(t, n.Watch(notifications))
+	<-notifications
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n.StopWatching()
+		}()
+	}
+	wg.Wait()
+
+	assert.Empty(t, collect(t, notifications))
+	n.StopWatching()
+}
+
+func TestWatchFuncAlreadyWatching(t *testing.T) {
+	server := streamServer(t, func(w http.ResponseWriter, r *http.Request, conn int) {
+		sendEvent(w, EventTypePut, `{"path":"/","data":1}`)
+		<-r.Context().Done()
+	})
+
+	n := New(server.URL, nil)
+	notifications := make(chan Event)
+	require.NoError(t, n.Watch(notifications))
+	<-notifications
+
+	stop, err := n.WatchFunc(func(Event) {})
+	assert.Equal(t, ErrAlreadyWatching, err)
+	assert.Nil(t, stop)
+
+	select {
+	case _, ok := <-notifications:
+		t.Fatalf("existing watch was affected, open: %v", ok)
+	case <-time.After(50 * time.Millisecond):
+	}
+	n.StopWatching()
+	collect(t, notifications)
+}
+
+func TestIsTerminal(t *testing.T) {
+	for typ, terminal := range map[string]bool{
+		EventTypePut:          false,
+		EventTypePatch:        false,
+		EventTypeReconnecting: false,
+		EventTypeError:        true,
+		EventTypeAuthRevoked:  true,
+		eventTypeCancel:       true,
+	} {
+		assert.Equal(t, terminal, Event{Type: typ}.IsTerminal(), typ)
+	}
+}
+
+func TestWatchAuthRevoked(t *testing.T) {
+	server := streamServer(t, func(w http.ResponseWriter, r *http.Request, conn int) {
+		sendEvent(w, EventTypeAuthRevoked, `"credential is no longer valid"`)
+	})
+
+	notifications := make(chan Event)
+	require.NoError(t, New(server.URL, nil).Watch(notifications))
+
+	events := collect(t, notifications)
+	require.Len(t, events, 1)
+	assert.Equal(t, "credential is no longer valid", events[0].Data)
+	assert.True(t, events[0].IsTerminal())
+}
+
+func TestWatchEventIDAndRetry(t *testing.T) {
+	server := streamServer(t, func(w http.ResponseWriter, r *http.Request, conn int) {
+		fmt.Fprint(w, "id: 42\nretry: 1500\nevent: put\ndata: {\"path\":\"/\",\"data\":1}\n\n")
+	})
+
+	n := New(server.URL, nil)
+	notifications := make(chan Event)
+	require.NoError(t, n.Watch(notifications))
+
+	events := collect(t, notifications)
+	require.NotEmpty(t, events)
+	assert.Equal(t, EventTypePut, events[0].Type)
+	assert.Equal(t, "42", events[0].ID)
+	assert.Equal(t, 1500, events[0].Retry)
+	assert.Equal(t, float64(1), events[0].Data)
+	assert.Equal(t, "42", n.LastEventID())
+}
+
+func TestWatchRedirect(t *testing.T) {
+	server := streamServer(t, func(w http.ResponseWriter, r *http.Request, conn int) {
+		if r.Header.Get("Accept") != "text/event-stream" {
+			writeError(w, http.StatusBadRequest, "not a stream")
+			return
+		}
+		sendEvent(w, EventTypePut, `{"path":"/","data":1}`)
+	})
+	redirect := redirectServer(t, server.URL)
+
+	notifications := make(chan Event)
+	require.NoError(t, New(redirect.URL, nil).Watch(notifications))
+
+	events := collect(t, notifications)
+	require.NotEmpty(t, events)
+	assert.Equal(t, EventTypePut, events[0].Type)
+	assert.Equal(t, float64(1), events[0].Data)
+}
+
+func TestWatchTimeout(t *testing.T) {
+	server := streamServer(t, func(w http.ResponseWriter, r *http.Request, conn int) {
+		sendEvent(w, EventTypePut, `{"path":"/","data":1}`)
+		<-r.Context().Done()
+	})
+
+	notifications := make(chan Event)
+	n := New(server.URL, nil, WithWatchTimeout(100*time.Millisecond))
+	require.NoError(t, n.Watch(notifications))
+
+	events := collect(t, notifications)
+	require.Len(t, events, 2)
+	assert.Equal(t, EventTypePut, events[0].Type)
+	assert.Equal(t, EventTypeError, events[1].Type)
+	assert.Contains(t, events[1].RawData, "no events received")
+}
+
+func TestWatchTimeoutSlowConsumer(t *testing.T) {
+	server := streamServer(t, func(w http.ResponseWriter, r *http.Request, conn int) {
+		for i := 1; ; i++ {
+			sendEvent(w, EventTypePut, fmt.Sprintf(`{"path":"/","data":%d}`, i))
+			select {
+			case <-time.After(50 * time.Millisecond):
+			case <-r.Context().Done():
+				return
+			}
+		}
+	})
+
+	notifications := make(chan Event)
+	n := New(server.URL, nil, WithWatchTimeout(300*time.Millisecond))
+	require.NoError(t, n.Watch(notifications))
+
+	for i := 0; i < 3; i++ {
+		event := <-notifications
+		assert.Equal(t, EventTypePut, event.Type, "%v", event.Data)
+		time.Sleep(600 * time.Millisecond)
+	}
+	n.StopWatching()
+	for _, event := range collect(t, notifications) {
+		assert.NotEqual(t, EventTypeError, event.Type, "%v", event.Data)
+	}
+}
+
+func TestWatchValueInitialNull(t *testing.T) {
+	server := streamServer(t, func(w http.ResponseWriter, r *http.Request, conn int) {
+		sendEvent(w, EventTypePut, `{"path":"/","data":null}`)
+		sendEvent(w, EventTypePut, `{"path":"/","data":null}`)
+		sendEvent(w, EventTypePut, `{"path":"/a","data":1}`)
+	})
+
+	notifications := make(chan Event)
+	require.NoError(t, New(server.URL, nil).WatchValue(notifications))
+
+	events := collect(t, notifications)
+	require.Len(t, events, 3)
+	assert.Equal(t, EventTypePut, events[0].Type)
+	assert.Nil(t, events[0].Data)
+	assert.Equal(t, "/a", events[1].Path)
+	assert.Equal(t, EventTypeError, events[2].Type)
+}
+
+func TestWatchRestartAfterEnd(t *testing.T) {
+	server := streamServer(t, func(w http.ResponseWriter, r *http.Request, conn int) {
+		sendEvent(w, EventTypePut, fmt.Sprintf(`{"path":"/","data":%d}`, conn))
+	})
+	n := New(server.URL, nil)
+
+	for conn := 1; conn <= 2; conn++ {
+		notifications := make(chan Event)
+		require.NoError(t, n.Watch(notifications))
+
+		events := collect(t, notifications)
+		require.NotEmpty(t, events)
+		assert.Equal(t, float64(conn), events[0].Data)
+		assert.Error(t, n.LastWatchError())
+	}
+}
+
+func TestLastWatchErrorUnauthorized(t *testing.T) {
+	server := streamServer(t, func(w http.ResponseWriter, r *http.Request, conn int) {
+		if conn > 1 {
+			writeError(w, http.StatusUnauthorized, "Permission denied")
+			return
+		}
+		sendEvent(w, EventTypePut, `{"path":"/","data":1}`)
+	})
+
+	n := New(server.URL, nil)
+	notifications := make(chan Event)
+	require.NoError(t, n.WatchWithReconnect(notifications))
+	collect(t, notifications)
+	assert.True(t, IsUnauthorized(n.LastWatchError()), "%v", n.LastWatchError())
+
+	err := n.Watch(make(chan Event))
+	assert.True(t, IsUnauthorized(err))
+	assert.Equal(t, err, n.LastWatchError())
+}
+
+func TestWatchSkipBadFrames(t *testing.T) {
+	server := streamServer(t, func(w http.ResponseWriter, r *http.Request, conn int) {
+		sendEvent(w, EventTypePut, `{"path":"/a","data":1}`)
+		sendEvent(w, EventTypePut, `{"path":"/b","da`)
+		sendEvent(w, EventTypePatch, "{\"path\":\"/\",\"data\":{\"c\":\"\xff\"}}")
+		sendEvent(w, EventTypePut, `{"path":"/d","data":2}`)
+	})
+
+	notifications := make(chan Event)
+	require.NoError(t, New(server.URL, nil, WithSkipBadFrames()).Watch(notifications))
+
+	events := collect(t, notifications)
+	var types []string
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	assert.Equal(t, []string{EventTypePut, EventTypeBadFrame, EventTypePatch, EventTypePut, EventTypeError}, types)
+	assert.Equal(t, "/d", events[3].Path)
+	assert.Equal(t, `{"path":"/b","da`, events[1].RawData)
+}
+
+func TestWatchRevokeVariant(t *testing.T) {
+	server := streamServer(t, func(w http.ResponseWriter, r *http.Request, conn int) {
+		sendEvent(w, EventTypePut, `{"path":"/","data":1}`)
+		sendEvent(w, "revoke", `"token revoked"`)
+		<-r.Context().Done()
+	})
+
+	notifications := make(chan Event)
+	require.NoError(t, New(server.URL, nil).WatchWithReconnect(notifications))
+
+	events := collect(t, notifications)
+	require.Len(t, events, 2)
+	assert.Equal(t, "revoke", events[1].Type)
+	assert.Equal(t, EventTypeAuthRevoked, events[1].NormalizedType)
+	assert.Equal(t, "token revoked", events[1].Data)
+	assert.True(t, events[1].IsTerminal())
+}
+
+func TestWatchDebouncedMergesPatches(t *testing.T) {
+	server := streamServer(t, func(w http.ResponseWriter, r *http.Request, conn int) {
+		sendEvent(w, EventTypePatch, `{"path":"/","data":{"a":1,"b/c":1}}`)
+		sendEvent(w, EventTypePatch, `{"path":"/","data":{"b":{"d":2},"e":3}}`)
+		sendEvent(w, EventTypePut, `{"path":"/p","data":{"a":1}}`)
+		sendEvent(w, EventTypePatch, `{"path":"/p","data":{"b":2}}`)
+		sendEvent(w, EventTypePatch, `{"path":"/q","data":{"a":1}}`)
+		sendEvent(w, EventTypePut, `{"path":"/q","data":2}`)
+		sendEvent(w, EventTypePatch, `{"path":"/r","data":{"b":{"x":1}}}`)
+		sendEvent(w, EventTypePatch, `{"path":"/r","data":{"b/y":2}}`)
+		<-r.Context().Done()
+	})
+
+	n := New(server.URL, nil)
+	notifications := make(chan Event)
+	require.NoError(t, n.WatchDebounced(100*time.Millisecond, notifications))
+
+	var events []Event
+	for len(events) < 4 {
+		select {
+		case event := <-notifications:
+			events = append(events, event)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the events")
+		}
+	}
+	n.StopWatching()
+	collect(t, notifications)
+
+	assert.Equal(t, EventTypePatch, events[0].Type)
+	var root map[string]interface{}
+	require.NoError(t, events[0].Value(&root))
+	assert.Equal(t, map[string]interface{}{
+		"a": float64(1),
+		"b": map[string]interface{}{"d": float64(2)},
+		"e": float64(3),
+	}, root)
+
+	assert.Equal(t, EventTypePut, events[1].Type)
+	assert.Equal(t, map[string]interface{}{"a": float64(1), "b": float64(2)}, events[1].Data)
+
+	assert.Equal(t, EventTypePut, events[2].Type)
+	assert.Equal(t, float64(2), events[2].Data)
+
+	assert.Equal(t, EventTypePatch, events[3].Type)
+	assert.Equal(t, map[string]interface{}{
+		"b": map[string]interface{}{"x": float64(1), "y": float64(2)},
+	}, events[3].Data)
+}
+
+func TestEventReceivedAt(t *testing.T) {
+	server := streamServer(t, func(w http.ResponseWriter, r *http.Request, conn int) {
+		sendEvent(w, EventTypePut, `{"path":"/","data":1}`)
+	})
+
+	before := time.Now()
+	notifications := make(chan Event)
+	require.NoError(t, New(server.URL, nil).Watch(notifications))
+
+	events := collect(t, notifications)
+	require.Len(t, events, 2)
+	for _, event := range events {
+		assert.False(t, event.ReceivedAt.Before(before), event.Type)
+		assert.False(t, event.ReceivedAt.After(time.Now()), event.Type)
+	}
+	assert.False(t, events[1].ReceivedAt.Before(events[0].ReceivedAt))
+}
+
+func TestWatchReauthOnRevoke(t *testing.T) {
+	var mtx sync.Mutex
+	var auth []string
+	server := streamServer(t, func(w http.ResponseWriter, r *http.Request, conn int) {
+		mtx.Lock()
+		auth = append(auth, r.Header.Get("Authorization"))
+		mtx.Unlock()
+		sendEvent(w, EventTypePut, fmt.Sprintf(`{"path":"/","data":%d}`, conn))
+		if conn == 1 {
+			sendEvent(w, EventTypeAuthRevoked, `"token expired"`)
+		}
+	})
+
+	var calls int32
+	n := New(server.URL, nil, WithReauthOnRevoke())
+	n.SetAuthProvider(func() (string, error) {
+		return fmt.Sprint("token", atomic.AddInt32(&calls, 1)), nil
+	})
+
+	notifications := make(chan Event)
+	require.NoError(t, n.Watch(notifications))
+
+	events := collect(t, notifications)
+	require.Len(t, events, 4)
+	assert.Equal(t, EventTypeReconnecting, events[1].Type)
+	assert.False(t, events[1].IsTerminal())
+	assert.Contains(t, events[1].RawData, "token expired")
+	assert.Equal(t, float64(2), events[2].Data)
+	mtx.Lock()
+	assert.Equal(t, []string{"Bearer token1", "Bearer token2"}, auth)
+	mtx.Unlock()
+	assert.EqualValues(t, 2, atomic.LoadInt32(&calls))
+}
+
+func TestWatchReauthProviderError(t *testing.T) {
+	server := streamServer(t, func(w http.ResponseWriter, r *http.Request, conn int) {
+		sendEvent(w, EventTypePut, `{"path":"/","data":1}`)
+		sendEvent(w, EventTypeAuthRevoked, `"token expired"`)
+	})
+
+	errNoToken := errors.New("no token")
+	var calls int32
+	n := New(server.URL, nil, WithReauthOnRevoke())
+	n.SetAuthProvider(func() (string, error) {
+		if atomic.AddInt32(&calls, 1) > 1 {
+			return "", errNoToken
+		}
+		return "token", nil
+	})
+
+	notifications := make(chan Event)
+	require.NoError(t, n.Watch(notifications))
+
+	events := collect(t, notifications)
+	require.Len(t, events, 2)
+	assert.Equal(t, EventTypeAuthRevoked, events[1].Type)
+	assert.True(t, errors.Is(n.LastWatchError(), errNoToken), "%v", n.LastWatchError())
+	assert.EqualValues(t, 2, atomic.LoadInt32(&calls))
+}
+
+func TestWatchLastEventIDOnReconnect(t *testing.T) {
+	lastIDs := make(chan string, 2)
+	server := streamServer(t, func(w http.ResponseWriter, r *http.Request, conn int) {
+		lastIDs <- r.Header.Get("Last-Event-ID")
+		fmt.Fprintf(w, "id: %d\nevent: put\ndata: {\"path\":\"/\",\"data\":%d}\n\n", conn, conn)
+		w.(http.Flusher).Flush()
+		if conn > 1 {
+			<-r.Context().Done()
+		}
+	})
+
+	n := New(server.URL, nil)
+	notifications := make(chan Event)
+	require.NoError(t, n.WatchWithReconnect(notifications))
+
+	var puts int
+	for event := range notifications {
+		if event.Type == EventTypePut {
+			if puts++; puts == 2 {
+				n.StopWatching()
+			}
+		}
+	}
+
+	assert.Equal(t, "", <-lastIDs)
+	assert.Equal(t, "1", <-lastIDs)
+	assert.Equal(t, "2", n.LastEventID())
+}
+
+func TestBufferEventsDropsOldest(t *testing.T) {
+	in := make(chan Event)
+	out := bufferEvents(in, 2, make(chan struct{}))
+
+	for i := 1; i <= 5; i++ {
+		in <- Event{Type: EventTypePut, Data: i}
+	}
+	close(in)
+
+	var data []interface{}
+	for event := range out {
+		data = append(data, event.Data)
+	}
+	assert.Equal(t, []interface{}{4, 5}, data)
+}
+
+func TestBufferEventsStop(t *testing.T) {
+	in := make(chan Event)
+	stop := make(chan struct{})
+	out := bufferEvents(in, 2, stop)
+
+	in <- Event{Type: EventTypePut}
+	close(stop)
+
+	// the parser isn't held up once stopped
+	in <- Event{Type: EventTypePut}
+	in <- Event{Type: EventTypePut}
+	in <- Event{Type: EventTypePut}
+	close(in)
+
+	for range out {
+	}
+}
+
+func TestWithEventBuffer(t *testing.T) {
+	sent := make(chan struct{})
+	server := streamServer(t, func(w http.ResponseWriter, r *http.Request, conn int) {
+		for i := 1; i <= 5; i++ {
+			sendEvent(w, EventTypePut, fmt.Sprintf(`{"path":"/","data":%d}`, i))
+		}
+		close(sent)
+		<-r.Context().Done()
+	})
+
+	n := New(server.URL, nil, WithEventBuffer(10))
+	notifications := make(chan Event)
+	require.NoError(t, n.Watch(notifications))
+
+	// the events are passed over in order once consumed
+	select {
+	case <-sent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the events to be sent")
+	}
+	for i := 1; i <= 5; i++ {
+		assert.Equal(t, float64(i), (<-notifications).Data)
+	}
+	n.StopWatching()
+	collect(t, notifications)
+}
+
+// writerFunc is an io.Writer that calls the func.
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+func TestDrainAndStop(t *testing.T) {
+	server := streamServer(t, func(w http.ResponseWriter, r *http.Request, conn int) {
+		for i := 1; i <= 3; i++ {
+			fmt.Fprintf(w, "event: put\ndata: {\"path\":\"/\",\"data\":%d}\n\n", i)
+		}
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	})
+
+	n := New(server.URL, nil, WithEventBuffer(10))
+	notifications := make(chan Event)
+	require.NoError(t, n.Watch(notifications))
+	assert.Equal(t, float64(1), (<-notifications).Data)
+
+	drained := make(chan error, 1)
+	go func() {
+		drained <- n.DrainAndStop(5 * time.Second)
+	}()
+
+	var data []interface{}
+	for _, event := range collect(t, notifications) {
+		data = append(data, event.Data)
+	}
+	assert.Equal(t, []interface{}{float64(2), float64(3)}, data)
+	assert.NoError(t, <-drained)
+	assert.NoError(t, n.LastWatchError())
+}
+
+func TestDrainAndStopTimeout(t *testing.T) {
+	server := streamServer(t, func(w http.ResponseWriter, r *http.Request, conn int) {
+		for i := 1; i <= 3; i++ {
+			sendEvent(w, EventTypePut, fmt.Sprintf(`{"path":"/","data":%d}`, i))
+		}
+		<-r.Context().Done()
+	})
+
+	read := make(chan struct{})
+	n := New(server.URL, nil, WithEventBuffer(10))
+	n.RawStreamWriter = writerFunc(func(p []byte) (int, error) {
+		if !isClosed(read) {
+			close(read)
+		}
+		return len(p), nil
+	})
+	notifications := make(chan Event)
+	require.NoError(t, n.Watch(notifications))
+	<-read
+
+	// nobody receives the events
+	err := n.DrainAndStop(100 * time.Millisecond)
+	assert.Error(t, err)
+	collect(t, notifications)
+
+	// the reference can be watched again
+	again := make(chan Event)
+	require.NoError(t, n.Watch(again))
+	n.StopWatching()
+	collect(t, again)
+
+	assert.NoError(t, n.DrainAndStop(time.Second))
+}